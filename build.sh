@@ -2,6 +2,8 @@
 
 IMAGE_NAME="javafuns/servicecache-operator:v0.0.1"
 
+CGO_ENABLED=0 GOOS=linux go build -o build/_output/bin/service-cache-proxy ./cmd/proxy
+
 operator-sdk build ${IMAGE_NAME}
 
 sed -i "s|REPLACE_IMAGE|${IMAGE_NAME}|g" deploy/operator.yaml
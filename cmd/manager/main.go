@@ -6,12 +6,16 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"service-cache-operator/pkg/apis"
 	"service-cache-operator/pkg/controller"
+	controller_utils "service-cache-operator/pkg/controller/utils"
+	"service-cache-operator/pkg/webhook"
+	"service-cache-operator/pkg/webhook/conversion"
 
 	"github.com/operator-framework/operator-sdk/pkg/k8sutil"
 	"github.com/operator-framework/operator-sdk/pkg/leader"
@@ -20,6 +24,10 @@ import (
 	"github.com/operator-framework/operator-sdk/pkg/restmapper"
 	sdkVersion "github.com/operator-framework/operator-sdk/version"
 	"github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
@@ -33,12 +41,61 @@ var (
 )
 var log = logf.Log.WithName("cmd")
 
+// migrationRetryInterval is how long the storage version migration waits before it's retried
+const migrationRetryInterval = 10 * time.Second
+
+var (
+	enableWebhooks = pflag.Bool("enable-webhooks", false, "Serve the admission webhooks, e.g. the cache proxy sidecar injection")
+	webhookPort    = pflag.Int32("webhook-port", 9876, "The port the admission webhooks are served on")
+	conversionPort = pflag.Int32("conversion-webhook-port", 9443,
+		"The port the conversion webhook of the ServiceCaches and the ServiceCachePurges is served on")
+	sourceOfTruth = pflag.String("source-of-truth", string(controller_utils.SourceOfTruthBidirectional),
+		"Which side holds the configuration when a Service and its ServiceCache are different: annotations, crd or bidirectional")
+	namespaceSelector = pflag.String("namespace-selector", "",
+		"Label selector of the namespaces opted in, e.g. service-cache=enabled; all the watched namespaces if empty")
+)
+
 func printVersion() {
 	log.Info(fmt.Sprintf("Go Version: %s", runtime.Version()))
 	log.Info(fmt.Sprintf("Go OS/Arch: %s/%s", runtime.GOOS, runtime.GOARCH))
 	log.Info(fmt.Sprintf("Version of operator-sdk: %v", sdkVersion.Version))
 }
 
+// migrateStorageVersion rewrites the objects stored in v1alpha1 in v1beta1. The API server may not reach the
+// conversion webhook right away: it's retried until it succeeds or stop is closed.
+func migrateStorageVersion(c client.Client, namespaces []string, stop <-chan struct{}) {
+	wait.PollImmediateUntil(migrationRetryInterval, func() (bool, error) {
+		rewritten, err := controller_utils.MigrateStorageVersion(c, namespaces)
+		if err != nil {
+			log.Info("Failed to migrate the ServiceCaches and the ServiceCachePurges to the storage version, retrying",
+				"error", err.Error())
+			return false, nil
+		}
+		if rewritten > 0 {
+			log.Info("Migrated the ServiceCaches and the ServiceCachePurges to the storage version", "Objects", rewritten)
+		}
+		return true, nil
+	}, stop)
+}
+
+// migrateOwnerReferences removes the owner references the previous versions of the operator set between the Services
+// and the ServiceCaches. Reading the ServiceCaches needs the conversion webhook: it's retried until it succeeds or stop
+// is closed.
+func migrateOwnerReferences(c client.Client, namespaces []string, stop <-chan struct{}) {
+	wait.PollImmediateUntil(migrationRetryInterval, func() (bool, error) {
+		migrated, err := controller_utils.MigrateOwnerReferences(c, namespaces)
+		if err != nil {
+			log.Info("Failed to remove the owner references between the Services and the ServiceCaches, retrying",
+				"error", err.Error())
+			return false, nil
+		}
+		if migrated > 0 {
+			log.Info("Removed the owner references between the Services and the ServiceCaches", "Objects", migrated)
+		}
+		return true, nil
+	}, stop)
+}
+
 func main() {
 	// Add the zap logger flag set to the CLI. The flag set must
 	// be added before calling pflag.Parse().
@@ -62,11 +119,13 @@ func main() {
 
 	printVersion()
 
+	// WATCH_NAMESPACE is a namespace, a comma-separated list of namespaces, or empty to watch all the namespaces
 	namespace, err := k8sutil.GetWatchNamespace()
 	if err != nil {
 		log.Error(err, "Failed to get watch namespace")
 		os.Exit(1)
 	}
+	namespaces := controller_utils.ParseWatchNamespaces(namespace)
 
 	// Get a config to talk to the apiserver
 	cfg, err := config.GetConfig()
@@ -75,7 +134,15 @@ func main() {
 		os.Exit(1)
 	}
 
+	// the operator has no namespace when it's not running in a cluster, e.g. with operator-sdk up local
+	operatorNamespace, errOfNamespace := k8sutil.GetOperatorNamespace()
+	if errOfNamespace != nil && errOfNamespace != k8sutil.ErrNoNamespace {
+		log.Error(errOfNamespace, "Failed to get operator namespace")
+		os.Exit(1)
+	}
+
 	ctx := context.TODO()
+	stop := signals.SetupSignalHandler()
 
 	// Become the leader before proceeding
 	err = leader.Become(ctx, "service-cache-operator-lock")
@@ -85,11 +152,20 @@ func main() {
 	}
 
 	// Create a new Cmd to provide shared dependencies and start components
-	mgr, err := manager.New(cfg, manager.Options{
-		Namespace:          namespace,
+	options := manager.Options{
 		MapperProvider:     restmapper.NewDynamicRESTMapper,
 		MetricsBindAddress: fmt.Sprintf("%s:%d", metricsHost, metricsPort),
-	})
+	}
+	switch len(namespaces) {
+	case 0:
+		log.Info("Watching all the namespaces")
+	case 1:
+		options.Namespace = namespaces[0]
+	default:
+		log.Info("Watching the namespaces", "Namespaces", namespaces)
+		options.NewCache = cache.MultiNamespacedCacheBuilder(namespaces)
+	}
+	mgr, err := manager.New(cfg, options)
 	if err != nil {
 		log.Error(err, "")
 		os.Exit(1)
@@ -104,21 +180,87 @@ func main() {
 	}
 
 	// Setup all Controllers
+	controller_utils.ControllerOptions.SourceOfTruth, err = controller_utils.ParseSourceOfTruth(*sourceOfTruth)
+	if err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
+	controller_utils.ControllerOptions.NamespaceSelector, err = controller_utils.ParseNamespaceSelector(*namespaceSelector)
+	if err != nil {
+		log.Error(err, "Invalid namespace selector")
+		os.Exit(1)
+	}
+	// the cache of the manager is not started yet, and may only hold some namespaces: read the API server directly
+	apiClient, err := client.New(cfg, client.Options{Scheme: mgr.GetScheme()})
+	if err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
+	controller_utils.ControllerOptions.NamespaceReader = apiClient
+	controller_utils.ControllerOptions.SidecarInjection = *enableWebhooks
+
+	// the API server needs the conversion webhook to read the objects stored in another version, even the operator's
+	if errOfNamespace == nil {
+		conversionServer := conversion.NewServer(apiClient, mgr.GetScheme(), operatorNamespace,
+			os.Getenv(k8sutil.PodNameEnvVar), *conversionPort)
+		if err := conversionServer.Install(); err != nil {
+			log.Error(err, "Failed to install the conversion webhook")
+			os.Exit(1)
+		}
+		go func() {
+			if err := conversionServer.Start(stop); err != nil {
+				log.Error(err, "Conversion webhook exited non-zero")
+				os.Exit(1)
+			}
+		}()
+		go migrateStorageVersion(apiClient, namespaces, stop)
+	} else {
+		log.Info("Not running in a cluster, the conversion webhook is not served and the objects are not migrated " +
+			"to the storage version")
+	}
+	// the previous versions of the operator let the ServiceCaches own their Services, remove these owner references
+	// before a ServiceCache is deleted
+	go migrateOwnerReferences(apiClient, namespaces, stop)
+
 	if err := controller.AddToManager(mgr); err != nil {
 		log.Error(err, "")
 		os.Exit(1)
 	}
 
+	// Setup all Webhooks
+	if *enableWebhooks {
+		if errOfNamespace != nil {
+			log.Error(errOfNamespace, "Failed to get operator namespace")
+			os.Exit(1)
+		}
+		if err := webhook.AddToManager(mgr, operatorNamespace, *webhookPort); err != nil {
+			log.Error(err, "")
+			os.Exit(1)
+		}
+	}
+
 	// Create Service object to expose the metrics port.
-	_, err = metrics.ExposeMetricsPort(ctx, metricsPort)
+	service, err := metrics.ExposeMetricsPort(ctx, metricsPort)
 	if err != nil {
 		log.Info(err.Error())
 	}
 
+	// Create the ServiceMonitor scraping the metrics of the operator, so that failing syncs can be alerted on
+	if service != nil {
+		_, err = metrics.CreateServiceMonitors(cfg, service.Namespace, []*v1.Service{service})
+		if err != nil {
+			log.Info("Could not create ServiceMonitor object", "error", err.Error())
+			// ErrServiceMonitorNotPresent is returned when the prometheus-operator isn't installed in the cluster
+			if err == metrics.ErrServiceMonitorNotPresent {
+				log.Info("Install prometheus-operator in your cluster to create ServiceMonitor objects", "error", err.Error())
+			}
+		}
+	}
+
 	log.Info("Starting the Cmd.")
 
 	// Start the Cmd
-	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(stop); err != nil {
 		log.Error(err, "Manager exited non-zero")
 		os.Exit(1)
 	}
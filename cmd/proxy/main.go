@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"runtime"
+	"time"
+
+	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+
+	"service-cache-operator/pkg/apis"
+	cachev1beta1 "service-cache-operator/pkg/apis/cache/v1beta1"
+	"service-cache-operator/pkg/httpcache"
+	"service-cache-operator/pkg/proxy"
+	"service-cache-operator/version"
+
+	"github.com/operator-framework/operator-sdk/pkg/log/zap"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/pflag"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/signals"
+)
+
+var log = logf.Log.WithName("cmd")
+
+var (
+	listenAddress         = pflag.String("listen", ":8080", "The address the proxy listens on")
+	adminListenAddress    = pflag.String("admin-listen", ":9080", "The address of the admin endpoints: /purge and /metrics")
+	upstream              = pflag.String("upstream", "", "The URL of the origin Service endpoints, e.g. http://my-service-origin:80")
+	serviceCacheName      = pflag.String("servicecache-name", "", "The name of the ServiceCache object configuring this proxy")
+	serviceCacheNamespace = pflag.String("servicecache-namespace", os.Getenv("POD_NAMESPACE"), "The namespace of the ServiceCache object configuring this proxy")
+	ttl                   = pflag.Duration("ttl", proxy.DefaultTTL, "How long a cached response is served before asking the origin again")
+	resyncPeriod          = pflag.Duration("resync-period", 30*time.Second, "How often the ServiceCache object is read again")
+	cacheDir              = pflag.String("cache-dir", "/var/cache/service-cache", "Where the Disk storage writes the cached responses")
+)
+
+// redisPasswordEnvVar is the environment variable holding the password of the Redis storage, set by the operator
+const redisPasswordEnvVar = "REDIS_PASSWORD"
+
+// purgeTokenEnvVar is the environment variable holding the token of the purge endpoint, set by the operator.
+// The purge endpoint rejects every request without it.
+const purgeTokenEnvVar = "PURGE_TOKEN"
+
+func printVersion() {
+	log.Info(fmt.Sprintf("Go Version: %s", runtime.Version()))
+	log.Info(fmt.Sprintf("Go OS/Arch: %s/%s", runtime.GOOS, runtime.GOARCH))
+	log.Info(fmt.Sprintf("Version of service-cache: %v", version.Version))
+}
+
+func main() {
+	pflag.CommandLine.AddFlagSet(zap.FlagSet())
+	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
+	pflag.Parse()
+
+	logf.SetLogger(zap.Logger())
+
+	printVersion()
+
+	target, err := url.Parse(*upstream)
+	if err != nil || target.Host == "" {
+		log.Error(err, "The --upstream flag must be an absolute URL", "upstream", *upstream)
+		os.Exit(1)
+	}
+	if *serviceCacheName == "" || *serviceCacheNamespace == "" {
+		log.Info("The --servicecache-name and --servicecache-namespace flags are required")
+		os.Exit(1)
+	}
+
+	// Get a config to talk to the apiserver
+	cfg, err := config.GetConfig()
+	if err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
+
+	scheme := k8sruntime.NewScheme()
+	if err := apis.AddToScheme(scheme); err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
+
+	key := types.NamespacedName{Name: *serviceCacheName, Namespace: *serviceCacheNamespace}
+	p := proxy.New(target, proxy.Config{TTL: *ttl})
+	metrics := proxy.NewMetrics(p, *serviceCacheNamespace, *serviceCacheName)
+	p.Metrics = metrics
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics, prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+
+	stop := signals.SetupSignalHandler()
+	go watchServiceCache(c, key, p, stop)
+
+	server := &http.Server{Addr: *listenAddress, Handler: p}
+	admin := http.NewServeMux()
+	admin.Handle("/purge", httpcache.NewPurgeHandler(p.Handler, os.Getenv(purgeTokenEnvVar)))
+	admin.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	adminServer := &http.Server{Addr: *adminListenAddress, Handler: admin}
+	go func() {
+		<-stop
+		adminServer.Shutdown(context.Background())
+		server.Shutdown(context.Background())
+	}()
+	go func() {
+		if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Error(err, "Admin server exited non-zero")
+			os.Exit(1)
+		}
+	}()
+
+	log.Info("Starting the proxy.", "listen", *listenAddress, "admin-listen", *adminListenAddress, "upstream", target.String())
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Error(err, "Proxy exited non-zero")
+		os.Exit(1)
+	}
+}
+
+// watchServiceCache reads the ServiceCache object every resync period and applies its configuration to p
+func watchServiceCache(c client.Client, key types.NamespacedName, p *proxy.Proxy, stop <-chan struct{}) {
+	logger := log.WithValues("ServiceCache.Namespace", key.Namespace, "ServiceCache.Name", key.Name)
+	ticker := time.NewTicker(*resyncPeriod)
+	defer ticker.Stop()
+	// the proxy starts with the default in-memory store
+	var storage *cachev1beta1.CacheStorage
+	for {
+		sc := &cachev1beta1.ServiceCache{}
+		if err := c.Get(context.TODO(), key, sc); err != nil {
+			// keep the last known configuration, the origin is still reachable through the proxy
+			logger.Error(err, "Failed to read the ServiceCache")
+		} else {
+			p.SetConfig(proxy.NewConfig(sc, *ttl))
+			if !reflect.DeepEqual(storage, sc.Spec.Storage) {
+				if err := setStore(p, sc); err != nil {
+					logger.Error(err, "Failed to create the storage, keep the previous one")
+				} else {
+					storage = sc.Spec.Storage
+				}
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// setStore replaces the store of p by the storage described by sc
+func setStore(p *proxy.Proxy, sc *cachev1beta1.ServiceCache) error {
+	s, err := proxy.NewStore(sc, *cacheDir, os.Getenv(redisPasswordEnvVar))
+	if err != nil {
+		return err
+	}
+	log.Info("Switching the storage of the cached responses", "Storage", sc.Spec.Storage)
+	if err := p.SetStore(s).Close(); err != nil {
+		log.Error(err, "Failed to close the previous storage")
+	}
+	return nil
+}
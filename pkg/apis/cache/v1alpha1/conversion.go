@@ -0,0 +1,114 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"service-cache-operator/pkg/apis/cache/v1beta1"
+	"service-cache-operator/pkg/apis/conversion"
+)
+
+// v1alpha1 is converted to and from the v1beta1 Hub
+var _ conversion.Convertible = &ServiceCache{}
+var _ conversion.Convertible = &ServiceCachePurge{}
+
+// v1beta1SpecKeys maps the JSON keys of the fields of ServiceCacheSpec named after the annotations of the Service to
+// their keys in v1beta1. The other fields have the same keys and types in both versions.
+var v1beta1SpecKeys = map[string]string{
+	keyOfDefault:              "cacheableByDefault",
+	keyOfURLs:                 "urls",
+	keyOfMode:                 "mode",
+	keyOfRules:                "rules",
+	keyOfStaleWhileRevalidate: "staleWhileRevalidate",
+	keyOfStaleIfError:         "staleIfError",
+}
+
+// ConvertTo converts sc to the v1beta1 ServiceCache dstRaw
+func (sc *ServiceCache) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*v1beta1.ServiceCache)
+	if !ok {
+		return fmt.Errorf("cannot convert a ServiceCache to %T", dstRaw)
+	}
+	dst.TypeMeta = sc.TypeMeta
+	dst.APIVersion = v1beta1.SchemeGroupVersion.String()
+	dst.ObjectMeta = *sc.ObjectMeta.DeepCopy()
+	if err := convertJSON(&sc.Spec, &dst.Spec, v1beta1SpecKeys); err != nil {
+		return err
+	}
+	return convertJSON(&sc.Status, &dst.Status, nil)
+}
+
+// ConvertFrom converts the v1beta1 ServiceCache srcRaw to sc
+func (sc *ServiceCache) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*v1beta1.ServiceCache)
+	if !ok {
+		return fmt.Errorf("cannot convert %T to a ServiceCache", srcRaw)
+	}
+	sc.TypeMeta = src.TypeMeta
+	sc.APIVersion = SchemeGroupVersion.String()
+	sc.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	// the keys of v1beta1 are accepted by the UnmarshalJSON of ServiceCacheSpec
+	sc.Spec = ServiceCacheSpec{}
+	if err := convertJSON(&src.Spec, &sc.Spec, nil); err != nil {
+		return err
+	}
+	sc.Status = ServiceCacheStatus{}
+	return convertJSON(&src.Status, &sc.Status, nil)
+}
+
+// ConvertTo converts p to the v1beta1 ServiceCachePurge dstRaw, both versions have the same fields
+func (p *ServiceCachePurge) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*v1beta1.ServiceCachePurge)
+	if !ok {
+		return fmt.Errorf("cannot convert a ServiceCachePurge to %T", dstRaw)
+	}
+	dst.TypeMeta = p.TypeMeta
+	dst.APIVersion = v1beta1.SchemeGroupVersion.String()
+	dst.ObjectMeta = *p.ObjectMeta.DeepCopy()
+	if err := convertJSON(&p.Spec, &dst.Spec, nil); err != nil {
+		return err
+	}
+	return convertJSON(&p.Status, &dst.Status, nil)
+}
+
+// ConvertFrom converts the v1beta1 ServiceCachePurge srcRaw to p, both versions have the same fields
+func (p *ServiceCachePurge) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*v1beta1.ServiceCachePurge)
+	if !ok {
+		return fmt.Errorf("cannot convert %T to a ServiceCachePurge", srcRaw)
+	}
+	p.TypeMeta = src.TypeMeta
+	p.APIVersion = SchemeGroupVersion.String()
+	p.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	p.Spec = ServiceCachePurgeSpec{}
+	if err := convertJSON(&src.Spec, &p.Spec, nil); err != nil {
+		return err
+	}
+	p.Status = ServiceCachePurgeStatus{}
+	return convertJSON(&src.Status, &p.Status, nil)
+}
+
+// convertJSON decodes the JSON encoding of in into out, renaming its top-level keys as told by keys
+func convertJSON(in, out interface{}, keys map[string]string) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		renamed := make(map[string]json.RawMessage, len(fields))
+		for k, v := range fields {
+			if key, ok := keys[k]; ok {
+				k = key
+			}
+			renamed[k] = v
+		}
+		if data, err = json.Marshal(renamed); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, out)
+}
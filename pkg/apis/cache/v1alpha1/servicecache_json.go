@@ -0,0 +1,105 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// The JSON keys of the fields of ServiceCacheSpec which are named after the annotations of the Service
+const (
+	keyOfDefault              = "service-cache.github.io/default"
+	keyOfURLs                 = "service-cache.github.io/URLs"
+	keyOfMode                 = "service-cache.github.io/mode"
+	keyOfRules                = "service-cache.github.io/rules"
+	keyOfStaleWhileRevalidate = "service-cache.github.io/stale-while-revalidate"
+	keyOfStaleIfError         = "service-cache.github.io/stale-if-error"
+)
+
+// specKeyAliases maps the other keys the fields of a ServiceCacheSpec have been written with to their JSON keys:
+// the names of the Go fields, as in the sample of the first releases, and the keys of v1beta1
+var specKeyAliases = map[string]string{
+	"CacheableByDefault":   keyOfDefault,
+	"cacheableByDefault":   keyOfDefault,
+	"URLs":                 keyOfURLs,
+	"urls":                 keyOfURLs,
+	"mode":                 keyOfMode,
+	"rules":                keyOfRules,
+	"staleWhileRevalidate": keyOfStaleWhileRevalidate,
+	"staleIfError":         keyOfStaleIfError,
+}
+
+// UnmarshalJSON decodes a ServiceCacheSpec, accepting the legacy forms of its fields besides its JSON keys: the
+// keys in specKeyAliases, "true" or "false" strings for CacheableByDefault, and a string for URLs, either a JSON
+// array or the bracketed comma-joined form of the annotation, e.g. "[/a,/b]".
+func (in *ServiceCacheSpec) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for alias, key := range specKeyAliases {
+		value, ok := fields[alias]
+		if !ok {
+			continue
+		}
+		delete(fields, alias)
+		// the JSON key wins over its aliases
+		if _, ok := fields[key]; !ok {
+			fields[key] = value
+		}
+	}
+	if value, ok := fields[keyOfDefault]; ok && isString(value) {
+		var s string
+		if json.Unmarshal(value, &s) == nil {
+			fields[keyOfDefault] = json.RawMessage(boolJSON(strings.TrimSpace(s) == "true"))
+		}
+	}
+	if value, ok := fields[keyOfURLs]; ok && isString(value) {
+		var s string
+		if json.Unmarshal(value, &s) == nil {
+			urls, err := json.Marshal(parseLegacyURLs(s))
+			if err != nil {
+				return err
+			}
+			fields[keyOfURLs] = urls
+		}
+	}
+
+	normalized, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	// spec has the fields of ServiceCacheSpec without its UnmarshalJSON method
+	type spec ServiceCacheSpec
+	decoded := spec{}
+	if err := json.Unmarshal(normalized, &decoded); err != nil {
+		return err
+	}
+	*in = ServiceCacheSpec(decoded)
+	return nil
+}
+
+// parseLegacyURLs returns the URLs of the string value of the URLs field, like the annotation of the Service
+func parseLegacyURLs(value string) []string {
+	value = strings.TrimSpace(value)
+	var urls []string
+	if err := json.Unmarshal([]byte(value), &urls); err == nil {
+		return urls
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
+// isString returns true if value is a JSON string
+func isString(value json.RawMessage) bool {
+	return strings.HasPrefix(strings.TrimSpace(string(value)), `"`)
+}
+
+func boolJSON(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
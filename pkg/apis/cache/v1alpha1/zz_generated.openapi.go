@@ -13,9 +13,333 @@ import (
 
 func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenAPIDefinition {
 	return map[string]common.OpenAPIDefinition{
-		"service-cache-operator/pkg/apis/cache/v1alpha1.ServiceCache":       schema_pkg_apis_cache_v1alpha1_ServiceCache(ref),
-		"service-cache-operator/pkg/apis/cache/v1alpha1.ServiceCacheSpec":   schema_pkg_apis_cache_v1alpha1_ServiceCacheSpec(ref),
-		"service-cache-operator/pkg/apis/cache/v1alpha1.ServiceCacheStatus": schema_pkg_apis_cache_v1alpha1_ServiceCacheStatus(ref),
+		"service-cache-operator/pkg/apis/cache/v1alpha1.CacheInvalidation":       schema_pkg_apis_cache_v1alpha1_CacheInvalidation(ref),
+		"service-cache-operator/pkg/apis/cache/v1alpha1.CacheKey":                schema_pkg_apis_cache_v1alpha1_CacheKey(ref),
+		"service-cache-operator/pkg/apis/cache/v1alpha1.CacheKeyField":           schema_pkg_apis_cache_v1alpha1_CacheKeyField(ref),
+		"service-cache-operator/pkg/apis/cache/v1alpha1.CacheKeyQuery":           schema_pkg_apis_cache_v1alpha1_CacheKeyQuery(ref),
+		"service-cache-operator/pkg/apis/cache/v1alpha1.CacheRule":               schema_pkg_apis_cache_v1alpha1_CacheRule(ref),
+		"service-cache-operator/pkg/apis/cache/v1alpha1.CacheStorage":            schema_pkg_apis_cache_v1alpha1_CacheStorage(ref),
+		"service-cache-operator/pkg/apis/cache/v1alpha1.RedisStorage":            schema_pkg_apis_cache_v1alpha1_RedisStorage(ref),
+		"service-cache-operator/pkg/apis/cache/v1alpha1.RequestCoalescing":       schema_pkg_apis_cache_v1alpha1_RequestCoalescing(ref),
+		"service-cache-operator/pkg/apis/cache/v1alpha1.ServiceCache":            schema_pkg_apis_cache_v1alpha1_ServiceCache(ref),
+		"service-cache-operator/pkg/apis/cache/v1alpha1.ServiceCacheCondition":   schema_pkg_apis_cache_v1alpha1_ServiceCacheCondition(ref),
+		"service-cache-operator/pkg/apis/cache/v1alpha1.ServiceCachePurge":       schema_pkg_apis_cache_v1alpha1_ServiceCachePurge(ref),
+		"service-cache-operator/pkg/apis/cache/v1alpha1.ServiceCachePurgeSpec":   schema_pkg_apis_cache_v1alpha1_ServiceCachePurgeSpec(ref),
+		"service-cache-operator/pkg/apis/cache/v1alpha1.ServiceCachePurgeStatus": schema_pkg_apis_cache_v1alpha1_ServiceCachePurgeStatus(ref),
+		"service-cache-operator/pkg/apis/cache/v1alpha1.ServiceCacheSpec":        schema_pkg_apis_cache_v1alpha1_ServiceCacheSpec(ref),
+		"service-cache-operator/pkg/apis/cache/v1alpha1.ServiceCacheStatus":      schema_pkg_apis_cache_v1alpha1_ServiceCacheStatus(ref),
+	}
+}
+
+func schema_pkg_apis_cache_v1alpha1_CacheInvalidation(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "CacheInvalidation describes which cached responses are deleted by the requests changing the origin",
+				Properties: map[string]spec.Schema{
+					"unsafeMethods": {
+						SchemaProps: spec.SchemaProps{
+							Description: "UnsafeMethods makes the successful POST, PUT, PATCH and DELETE requests, and the other unsafe methods, to a path matched by a rule delete the cached responses of that path",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"locations": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Locations also deletes the cached responses of the paths in the Location and Content-Location headers of their responses",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"rollout": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Rollout stops serving the cached responses when the pods of the Service roll out a new version, by incrementing the cache generation in the status",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{},
+	}
+}
+
+func schema_pkg_apis_cache_v1alpha1_CacheKey(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "CacheKey describes which parts of a request identify its cached response, in addition to its method and path",
+				Properties: map[string]spec.Schema{
+					"includeHost": {
+						SchemaProps: spec.SchemaProps{
+							Description: "IncludeHost adds the Host of the request to the key",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"query": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Query selects and normalizes the query parameters in the key. The raw query is in the key if not set.",
+							Ref:         ref("service-cache-operator/pkg/apis/cache/v1alpha1.CacheKeyQuery"),
+						},
+					},
+					"headers": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Headers are the request headers in the key, in addition to the Vary headers of the rules",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("service-cache-operator/pkg/apis/cache/v1alpha1.CacheKeyField"),
+									},
+								},
+							},
+						},
+					},
+					"cookies": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Cookies are the request cookies in the key",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("service-cache-operator/pkg/apis/cache/v1alpha1.CacheKeyField"),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"service-cache-operator/pkg/apis/cache/v1alpha1.CacheKeyField", "service-cache-operator/pkg/apis/cache/v1alpha1.CacheKeyQuery"},
+	}
+}
+
+func schema_pkg_apis_cache_v1alpha1_CacheKeyField(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "CacheKeyField is a request header or cookie in a cache key",
+				Properties: map[string]spec.Schema{
+					"name": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Name of the header or cookie",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"hash": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Hash puts a hash of the value in the key instead of the value, e.g. for the Authorization header",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"name"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_cache_v1alpha1_CacheKeyQuery(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "CacheKeyQuery selects the query parameters in a cache key. They are sorted by name, and decoded and encoded again so that different encodings of the same parameters give the same key.",
+				Properties: map[string]spec.Schema{
+					"include": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Include are the names of the only parameters in the key, all of them if empty. A name ending with \"*\" matches every name with that prefix.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"exclude": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Exclude are the names of the parameters left out of the key, e.g. \"utm_*\"",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"preserveOrder": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PreserveOrder keeps the parameters in the order of the request, instead of sorting them by name",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_cache_v1alpha1_CacheRule(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "CacheRule describes which requests are cached and for how long",
+				Properties: map[string]spec.Schema{
+					"path": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Path is matched against the path of the request according to PathType",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"pathType": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PathType is how Path is matched, \"Prefix\" if empty",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"methods": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Methods are the cacheable HTTP methods, GET or HEAD, both if empty",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"ttl": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TTL is how long a response is cached, the default TTL of the proxy if not set",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+					"vary": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Vary are the request headers which are part of the cache key, e.g. Accept-Language",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+				},
+				Required: []string{"path"},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Duration"},
+	}
+}
+
+func schema_pkg_apis_cache_v1alpha1_CacheStorage(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "CacheStorage describes where the cached responses are stored",
+				Properties: map[string]spec.Schema{
+					"type": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Type is where the cached responses are stored, \"Memory\" if empty",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"maxSize": {
+						SchemaProps: spec.SchemaProps{
+							Description: "MaxSize bounds the size of the cached responses of each proxy replica, for the Memory and Disk storages",
+							Ref:         ref("k8s.io/apimachinery/pkg/api/resource.Quantity"),
+						},
+					},
+					"redis": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Redis is the server of the Redis storage",
+							Ref:         ref("service-cache-operator/pkg/apis/cache/v1alpha1.RedisStorage"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/api/resource.Quantity", "service-cache-operator/pkg/apis/cache/v1alpha1.RedisStorage"},
+	}
+}
+
+func schema_pkg_apis_cache_v1alpha1_RedisStorage(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "RedisStorage describes a Redis server storing the cached responses",
+				Properties: map[string]spec.Schema{
+					"address": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Address is the host:port of the server",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"database": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Database is the number of the database on the server",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"passwordSecretRef": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PasswordSecretRef selects the key of a Secret holding the password of the server, in the namespace of the ServiceCache",
+							Ref:         ref("k8s.io/api/core/v1.SecretKeySelector"),
+						},
+					},
+				},
+				Required: []string{"address"},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/api/core/v1.SecretKeySelector"},
+	}
+}
+
+func schema_pkg_apis_cache_v1alpha1_RequestCoalescing(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "RequestCoalescing describes how the concurrent requests missing the same cached response are coalesced",
+				Properties: map[string]spec.Schema{
+					"waitTimeout": {
+						SchemaProps: spec.SchemaProps{
+							Description: "WaitTimeout is how long a request waits for the response to a concurrent request, before being forwarded to the origin itself. 5s if not set.",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Duration"},
 	}
 }
 
@@ -62,6 +386,230 @@ func schema_pkg_apis_cache_v1alpha1_ServiceCache(ref common.ReferenceCallback) c
 	}
 }
 
+func schema_pkg_apis_cache_v1alpha1_ServiceCacheCondition(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ServiceCacheCondition describes the state of a ServiceCache at a certain point",
+				Properties: map[string]spec.Schema{
+					"type": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Type of the condition",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Status of the condition, one of True, False, Unknown",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"lastTransitionTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastTransitionTime is the last time the condition transitioned from one status to another",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"reason": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Reason is a one-word CamelCase reason for the last transition",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"message": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Message is a human-readable message about the last transition",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"type", "status"},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+	}
+}
+
+func schema_pkg_apis_cache_v1alpha1_ServiceCachePurge(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ServiceCachePurge is the Schema for the servicecachepurges API. It deletes cached responses of a Service once.",
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+						},
+					},
+					"spec": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("service-cache-operator/pkg/apis/cache/v1alpha1.ServiceCachePurgeSpec"),
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("service-cache-operator/pkg/apis/cache/v1alpha1.ServiceCachePurgeStatus"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta", "service-cache-operator/pkg/apis/cache/v1alpha1.ServiceCachePurgeSpec", "service-cache-operator/pkg/apis/cache/v1alpha1.ServiceCachePurgeStatus"},
+	}
+}
+
+func schema_pkg_apis_cache_v1alpha1_ServiceCachePurgeSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ServiceCachePurgeSpec describes the cached responses to delete from the cache of a Service. A response is deleted if it matches any of the fields.",
+				Properties: map[string]spec.Schema{
+					"serviceCacheName": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ServiceCacheName is the name of the ServiceCache whose cached responses are deleted, in the same namespace",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"all": {
+						SchemaProps: spec.SchemaProps{
+							Description: "All deletes all the cached responses",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"keys": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Keys delete the responses to the requests with these targets, path and query, e.g. \"/items/42?lang=en\"",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"pathPrefixes": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PathPrefixes delete the responses to the requests whose path starts with one of them",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"pathRegexes": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PathRegexes delete the responses to the requests whose path matches one of these regular expressions",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"tags": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Tags delete the responses with one of these tags in their Surrogate-Key header",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+				},
+				Required: []string{"serviceCacheName"},
+			},
+		},
+		Dependencies: []string{},
+	}
+}
+
+func schema_pkg_apis_cache_v1alpha1_ServiceCachePurgeStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ServiceCachePurgeStatus defines the observed state of ServiceCachePurge",
+				Properties: map[string]spec.Schema{
+					"phase": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Phase is the progress of the purge",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"replicas": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Replicas is the number of cache proxy replicas which have done the purge",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"purged": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Purged is the number of deleted responses, summed over the cache proxy replicas",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+					"completionTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CompletionTime is when the purge was done by every cache proxy replica",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"message": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Message tells why the purge is not completed",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+	}
+}
+
 func schema_pkg_apis_cache_v1alpha1_ServiceCacheSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -79,9 +627,65 @@ func schema_pkg_apis_cache_v1alpha1_ServiceCacheStatus(ref common.ReferenceCallb
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
 				Description: "ServiceCacheStatus defines the observed state of ServiceCache",
-				Properties:  map[string]spec.Schema{},
+				Properties: map[string]spec.Schema{
+					"observedGeneration": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ObservedGeneration is the generation of the ServiceCache the status has been computed for",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+					"conditions": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Conditions are the latest observations of the state of the ServiceCache",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("service-cache-operator/pkg/apis/cache/v1alpha1.ServiceCacheCondition"),
+									},
+								},
+							},
+						},
+					},
+					"lastSyncTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastSyncTime is the last time the ServiceCache has been synced with its Service",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"serviceResourceVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ServiceResourceVersion is the resourceVersion of the Service the ServiceCache has last been synced with",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"cacheGeneration": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CacheGeneration is part of the keys of the cached responses, the responses cached with a previous generation are not served. It's incremented when the pods of the Service roll out a new version, with invalidation.rollout.",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+					"observedRevisions": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ObservedRevisions are the versions of the ready pods of the Service, the values of their pod-template-hash or controller-revision-hash label, when the cache generation was last computed",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+				},
 			},
 		},
-		Dependencies: []string{},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Time", "service-cache-operator/pkg/apis/cache/v1alpha1.ServiceCacheCondition"},
 	}
 }
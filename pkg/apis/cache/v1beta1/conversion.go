@@ -0,0 +1,15 @@
+package v1beta1
+
+import (
+	"service-cache-operator/pkg/apis/conversion"
+)
+
+// v1beta1 is the storage version, the other versions are converted to and from it
+var _ conversion.Hub = &ServiceCache{}
+var _ conversion.Hub = &ServiceCachePurge{}
+
+// Hub marks ServiceCache as the version the other versions are converted to and from
+func (*ServiceCache) Hub() {}
+
+// Hub marks ServiceCachePurge as the version the other versions are converted to and from
+func (*ServiceCachePurge) Hub() {}
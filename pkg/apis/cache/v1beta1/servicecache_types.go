@@ -0,0 +1,272 @@
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CacheMode is how the traffic of a Service goes through the cache
+type CacheMode string
+
+const (
+	// CacheModeProxy routes the traffic of the Service through a cache proxy Deployment
+	CacheModeProxy CacheMode = "proxy"
+	// CacheModeSidecar injects a cache proxy sidecar into the pods selected by the Service
+	CacheModeSidecar CacheMode = "sidecar"
+)
+
+// PathMatchType is how the path of a CacheRule is matched against the path of a request
+type PathMatchType string
+
+const (
+	// PathMatchExact matches the requests with exactly the path
+	PathMatchExact PathMatchType = "Exact"
+	// PathMatchPrefix matches the requests whose path starts with the path
+	PathMatchPrefix PathMatchType = "Prefix"
+	// PathMatchRegex matches the requests whose path matches the regular expression
+	PathMatchRegex PathMatchType = "Regex"
+)
+
+// CacheRule describes which requests are cached and for how long
+// +k8s:openapi-gen=true
+type CacheRule struct {
+	// Path is matched against the path of the request according to PathType
+	// +kubebuilder:validation:MinLength=1
+	Path string `json:"path"`
+	// PathType is how Path is matched, "Prefix" if empty
+	// +kubebuilder:validation:Enum=Exact,Prefix,Regex
+	PathType PathMatchType `json:"pathType,omitempty"`
+	// Methods are the cacheable HTTP methods, GET or HEAD, both if empty
+	Methods []string `json:"methods,omitempty"`
+	// TTL is how long a response is cached, the default TTL of the proxy if not set
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+	// Vary are the request headers which are part of the cache key, e.g. Accept-Language
+	Vary []string `json:"vary,omitempty"`
+}
+
+// CacheKey describes which parts of a request identify its cached response, in addition to its method and path
+// +k8s:openapi-gen=true
+type CacheKey struct {
+	// IncludeHost adds the Host of the request to the key
+	IncludeHost bool `json:"includeHost,omitempty"`
+	// Query selects and normalizes the query parameters in the key. The raw query is in the key if not set.
+	Query *CacheKeyQuery `json:"query,omitempty"`
+	// Headers are the request headers in the key, in addition to the Vary headers of the rules
+	Headers []CacheKeyField `json:"headers,omitempty"`
+	// Cookies are the request cookies in the key
+	Cookies []CacheKeyField `json:"cookies,omitempty"`
+}
+
+// CacheKeyQuery selects the query parameters in a cache key. They are sorted by name, and decoded and encoded again
+// so that different encodings of the same parameters give the same key.
+// +k8s:openapi-gen=true
+type CacheKeyQuery struct {
+	// Include are the names of the only parameters in the key, all of them if empty.
+	// A name ending with "*" matches every name with that prefix.
+	Include []string `json:"include,omitempty"`
+	// Exclude are the names of the parameters left out of the key, e.g. "utm_*"
+	Exclude []string `json:"exclude,omitempty"`
+	// PreserveOrder keeps the parameters in the order of the request, instead of sorting them by name
+	PreserveOrder bool `json:"preserveOrder,omitempty"`
+}
+
+// CacheKeyField is a request header or cookie in a cache key
+// +k8s:openapi-gen=true
+type CacheKeyField struct {
+	// Name of the header or cookie
+	// +kubebuilder:validation:Pattern=^[!#$%&'*+.^_`|~0-9A-Za-z-]+$
+	Name string `json:"name"`
+	// Hash puts a hash of the value in the key instead of the value, e.g. for the Authorization header
+	Hash bool `json:"hash,omitempty"`
+}
+
+// HeaderPolicy is how the caching headers of the origin responses and of the client requests (Cache-Control, Expires,
+// Pragma, Vary, Age) combine with the configured TTL
+type HeaderPolicy string
+
+const (
+	// HeaderPolicyRespect caches the responses as told by the headers, the TTL only applies to the responses without
+	// explicit freshness
+	HeaderPolicyRespect HeaderPolicy = "Respect"
+	// HeaderPolicyOverride caches the responses for the TTL, whatever the headers
+	HeaderPolicyOverride HeaderPolicy = "Override"
+	// HeaderPolicyStricter caches the responses for the TTL, unless the headers are stricter: shorter freshness,
+	// no-store, private...
+	HeaderPolicyStricter HeaderPolicy = "Stricter"
+)
+
+// StorageType is where the cache proxy stores the cached responses
+type StorageType string
+
+const (
+	// StorageMemory keeps the cached responses in the memory of each proxy replica
+	StorageMemory StorageType = "Memory"
+	// StorageDisk keeps the cached responses in files of each proxy replica, for large responses
+	StorageDisk StorageType = "Disk"
+	// StorageRedis keeps the cached responses in a Redis server shared by the proxy replicas
+	StorageRedis StorageType = "Redis"
+)
+
+// CacheStorage describes where the cached responses are stored
+// +k8s:openapi-gen=true
+type CacheStorage struct {
+	// Type is where the cached responses are stored, "Memory" if empty
+	// +kubebuilder:validation:Enum=Memory,Disk,Redis
+	Type StorageType `json:"type,omitempty"`
+	// MaxSize bounds the size of the cached responses of each proxy replica, for the Memory and Disk storages
+	MaxSize *resource.Quantity `json:"maxSize,omitempty"`
+	// Redis is the server of the Redis storage
+	Redis *RedisStorage `json:"redis,omitempty"`
+}
+
+// RedisStorage describes a Redis server storing the cached responses
+// +k8s:openapi-gen=true
+type RedisStorage struct {
+	// Address is the host:port of the server
+	// +kubebuilder:validation:Pattern=^.+:[0-9]+$
+	Address string `json:"address"`
+	// Database is the number of the database on the server
+	// +kubebuilder:validation:Minimum=0
+	Database int32 `json:"database,omitempty"`
+	// PasswordSecretRef selects the key of a Secret holding the password of the server, in the namespace of the
+	// ServiceCache
+	PasswordSecretRef *corev1.SecretKeySelector `json:"passwordSecretRef,omitempty"`
+}
+
+// RequestCoalescing describes how the concurrent requests missing the same cached response are coalesced
+// +k8s:openapi-gen=true
+type RequestCoalescing struct {
+	// WaitTimeout is how long a request waits for the response to a concurrent request, before being forwarded to the
+	// origin itself. 5s if not set.
+	WaitTimeout *metav1.Duration `json:"waitTimeout,omitempty"`
+}
+
+// CacheInvalidation describes which cached responses are deleted by the requests changing the origin
+// +k8s:openapi-gen=true
+type CacheInvalidation struct {
+	// UnsafeMethods makes the successful POST, PUT, PATCH and DELETE requests, and the other unsafe methods, to a path
+	// matched by a rule delete the cached responses of that path
+	UnsafeMethods bool `json:"unsafeMethods,omitempty"`
+	// Locations also deletes the cached responses of the paths in the Location and Content-Location headers of their
+	// responses
+	Locations bool `json:"locations,omitempty"`
+	// Rollout stops serving the cached responses when the pods of the Service roll out a new version, by incrementing
+	// the cache generation in the status
+	Rollout bool `json:"rollout,omitempty"`
+}
+
+// ServiceCacheSpec defines the desired state of ServiceCache.
+// Unlike in v1alpha1, the fields which have an annotation on the Service are not named after it.
+// +k8s:openapi-gen=true
+type ServiceCacheSpec struct {
+	// CacheableByDefault makes every GET response cacheable, not only the ones listed in URLs and Rules
+	CacheableByDefault bool `json:"cacheableByDefault,omitempty"`
+	// URLs are the paths of the cacheable requests, e.g. "/healthz"
+	URLs []string `json:"urls,omitempty"`
+	// Mode is how the traffic goes through the cache, "proxy" if empty
+	// +kubebuilder:validation:Enum=proxy,sidecar
+	Mode CacheMode `json:"mode,omitempty"`
+	// Rules are the cacheable requests, in addition to URLs. The first matching rule applies.
+	Rules []CacheRule `json:"rules,omitempty"`
+	// StaleWhileRevalidate is how long a response is still served after it expires, while it's refreshed in the
+	// background
+	StaleWhileRevalidate *metav1.Duration `json:"staleWhileRevalidate,omitempty"`
+	// StaleIfError is how long a response is still served after it expires, when the origin fails with a 5xx error or
+	// has no ready endpoints
+	StaleIfError *metav1.Duration `json:"staleIfError,omitempty"`
+	// HeaderPolicy is how the caching headers of the responses and of the requests combine with the TTL,
+	// "Stricter" if empty. It's set on the ServiceCache only, there's no annotation for it.
+	// +kubebuilder:validation:Enum=Respect,Override,Stricter
+	HeaderPolicy HeaderPolicy `json:"headerPolicy,omitempty"`
+	// Storage is where the cached responses are stored, in memory if not set.
+	// It's set on the ServiceCache only, there's no annotation for it.
+	Storage *CacheStorage `json:"storage,omitempty"`
+	// Coalescing makes the concurrent requests missing the same response wait for a single request to the origin,
+	// when set. It's set on the ServiceCache only, there's no annotation for it.
+	Coalescing *RequestCoalescing `json:"coalescing,omitempty"`
+	// CacheKey tells which parts of the requests identify their cached responses, their method, path and raw query if
+	// not set. It's set on the ServiceCache only, there's no annotation for it.
+	CacheKey *CacheKey `json:"cacheKey,omitempty"`
+	// Invalidation tells which cached responses are deleted by the requests changing the origin, none if not set.
+	// It's set on the ServiceCache only, there's no annotation for it.
+	Invalidation *CacheInvalidation `json:"invalidation,omitempty"`
+}
+
+// ServiceCacheConditionType is the type of a ServiceCacheCondition
+type ServiceCacheConditionType string
+
+const (
+	// ConditionReady is true when the responses of the Service are actually cached
+	ConditionReady ServiceCacheConditionType = "Ready"
+	// ConditionSynced is true when the ServiceCache and the annotations of its Service have the same configuration
+	ConditionSynced ServiceCacheConditionType = "Synced"
+	// ConditionInvalid is true when the configuration of the ServiceCache or of its Service is rejected
+	ConditionInvalid ServiceCacheConditionType = "Invalid"
+	// ConditionProxyAvailable is true when the traffic of the Service goes through an available cache proxy
+	ConditionProxyAvailable ServiceCacheConditionType = "ProxyAvailable"
+)
+
+// ServiceCacheCondition describes the state of a ServiceCache at a certain point
+// +k8s:openapi-gen=true
+type ServiceCacheCondition struct {
+	// Type of the condition
+	Type ServiceCacheConditionType `json:"type"`
+	// Status of the condition, one of True, False, Unknown
+	Status corev1.ConditionStatus `json:"status"`
+	// LastTransitionTime is the last time the condition transitioned from one status to another
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// Reason is a one-word CamelCase reason for the last transition
+	Reason string `json:"reason,omitempty"`
+	// Message is a human-readable message about the last transition
+	Message string `json:"message,omitempty"`
+}
+
+// ServiceCacheStatus defines the observed state of ServiceCache
+// +k8s:openapi-gen=true
+type ServiceCacheStatus struct {
+	// ObservedGeneration is the generation of the ServiceCache the status has been computed for
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions are the latest observations of the state of the ServiceCache
+	Conditions []ServiceCacheCondition `json:"conditions,omitempty"`
+	// LastSyncTime is the last time the ServiceCache has been synced with its Service
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	// ServiceResourceVersion is the resourceVersion of the Service the ServiceCache has last been synced with
+	ServiceResourceVersion string `json:"serviceResourceVersion,omitempty"`
+	// CacheGeneration is part of the keys of the cached responses, the responses cached with a previous generation are
+	// not served. It's incremented when the pods of the Service roll out a new version, with invalidation.rollout.
+	CacheGeneration int64 `json:"cacheGeneration,omitempty"`
+	// ObservedRevisions are the versions of the ready pods of the Service, the values of their pod-template-hash or
+	// controller-revision-hash label, when the cache generation was last computed
+	ObservedRevisions []string `json:"observedRevisions,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ServiceCache is the Schema for the servicecaches API
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=servicecaches,shortName=svcc
+// +kubebuilder:printcolumn:name="Default",type="boolean",JSONPath=".spec.cacheableByDefault",description="Whether every GET response is cacheable"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type ServiceCache struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ServiceCacheSpec   `json:"spec,omitempty"`
+	Status ServiceCacheStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ServiceCacheList contains a list of ServiceCache
+type ServiceCacheList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ServiceCache `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ServiceCache{}, &ServiceCacheList{})
+}
@@ -0,0 +1,82 @@
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ServiceCachePurgeSpec describes the cached responses to delete from the cache of a Service.
+// A response is deleted if it matches any of the fields.
+// +k8s:openapi-gen=true
+type ServiceCachePurgeSpec struct {
+	// ServiceCacheName is the name of the ServiceCache whose cached responses are deleted, in the same namespace
+	// +kubebuilder:validation:MinLength=1
+	ServiceCacheName string `json:"serviceCacheName"`
+	// All deletes all the cached responses
+	All bool `json:"all,omitempty"`
+	// Keys delete the responses to the requests with these targets, path and query, e.g. "/items/42?lang=en"
+	Keys []string `json:"keys,omitempty"`
+	// PathPrefixes delete the responses to the requests whose path starts with one of them
+	PathPrefixes []string `json:"pathPrefixes,omitempty"`
+	// PathRegexes delete the responses to the requests whose path matches one of these regular expressions
+	PathRegexes []string `json:"pathRegexes,omitempty"`
+	// Tags delete the responses with one of these tags in their Surrogate-Key header
+	Tags []string `json:"tags,omitempty"`
+}
+
+// PurgePhase is the progress of a ServiceCachePurge
+type PurgePhase string
+
+const (
+	// PurgePending is the phase of a purge not sent to every cache proxy yet
+	PurgePending PurgePhase = "Pending"
+	// PurgeCompleted is the phase of a purge done by every cache proxy
+	PurgeCompleted PurgePhase = "Completed"
+	// PurgeFailed is the phase of a purge which cannot be done, e.g. because its ServiceCache doesn't exist
+	PurgeFailed PurgePhase = "Failed"
+)
+
+// ServiceCachePurgeStatus defines the observed state of ServiceCachePurge
+// +k8s:openapi-gen=true
+type ServiceCachePurgeStatus struct {
+	// Phase is the progress of the purge
+	Phase PurgePhase `json:"phase,omitempty"`
+	// Replicas is the number of cache proxy replicas which have done the purge
+	Replicas int32 `json:"replicas,omitempty"`
+	// Purged is the number of deleted responses, summed over the cache proxy replicas
+	Purged int64 `json:"purged,omitempty"`
+	// CompletionTime is when the purge was done by every cache proxy replica
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Message tells why the purge is not completed
+	Message string `json:"message,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ServiceCachePurge is the Schema for the servicecachepurges API. It deletes cached responses of a Service once.
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=servicecachepurges,shortName=svccp
+// +kubebuilder:printcolumn:name="ServiceCache",type="string",JSONPath=".spec.serviceCacheName"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Purged",type="integer",JSONPath=".status.purged",description="The number of deleted responses"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type ServiceCachePurge struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ServiceCachePurgeSpec   `json:"spec,omitempty"`
+	Status ServiceCachePurgeStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ServiceCachePurgeList contains a list of ServiceCachePurge
+type ServiceCachePurgeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ServiceCachePurge `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ServiceCachePurge{}, &ServiceCachePurgeList{})
+}
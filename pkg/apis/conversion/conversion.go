@@ -0,0 +1,25 @@
+// Package conversion defines the interfaces of the types converted between the versions of the API by the conversion
+// webhook, like sigs.k8s.io/controller-runtime/pkg/conversion which the version of controller-runtime used here lacks.
+//
+// Every version is converted to and from a single Hub version, the storage version, by its own functions: a new
+// version only needs to be converted to and from the Hub.
+package conversion
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Hub is the type of the version the other versions of a kind are converted to and from
+type Hub interface {
+	runtime.Object
+	Hub()
+}
+
+// Convertible is the type of a version of a kind converted to and from its Hub
+type Convertible interface {
+	runtime.Object
+	// ConvertTo converts the receiver to dst
+	ConvertTo(dst Hub) error
+	// ConvertFrom converts src to the receiver
+	ConvertFrom(src Hub) error
+}
@@ -0,0 +1,146 @@
+// Package cachekey builds the keys identifying the cached responses to requests.
+package cachekey
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Config tells which parts of a request are in its key. The method and the path always are.
+type Config struct {
+	// Host adds the Host of the request to the key
+	Host bool
+	// Query selects and normalizes the query parameters in the key. The raw query is in the key if it's nil.
+	Query *Query
+	// Headers are the request headers in the key
+	Headers []Field
+	// Cookies are the request cookies in the key
+	Cookies []Field
+}
+
+// Query selects the query parameters in a key. They are decoded and encoded again, so that different encodings of
+// the same parameters give the same key.
+type Query struct {
+	// Include are the names of the only parameters in the key, all of them if empty.
+	// A name ending with "*" matches every name with that prefix.
+	Include []string
+	// Exclude are the names of the parameters left out of the key, e.g. "utm_*"
+	Exclude []string
+	// PreserveOrder keeps the parameters in the order of the request, instead of sorting them by name
+	PreserveOrder bool
+}
+
+// Field is a request header or cookie in a key
+type Field struct {
+	Name string
+	// Hash puts a hash of the value in the key instead of the value, e.g. for the Authorization header
+	Hash bool
+}
+
+// Builder builds the keys of requests according to a Config
+type Builder struct {
+	config Config
+}
+
+// New returns a Builder of the keys described by config
+func New(config Config) *Builder {
+	b := &Builder{config: config}
+	b.config.Headers = make([]Field, len(config.Headers))
+	for i, h := range config.Headers {
+		b.config.Headers[i] = Field{Name: http.CanonicalHeaderKey(h.Name), Hash: h.Hash}
+	}
+	return b
+}
+
+// Key returns the key of req
+func (b *Builder) Key(req *http.Request) string {
+	var k strings.Builder
+	k.WriteString(req.Method)
+	k.WriteString(" ")
+	if b.config.Host {
+		k.WriteString(strings.ToLower(req.Host))
+	}
+	k.WriteString(req.URL.Path)
+	if query := b.query(req.URL.RawQuery); query != "" {
+		k.WriteString("?")
+		k.WriteString(query)
+	}
+	for _, h := range b.config.Headers {
+		k.WriteString("\n")
+		k.WriteString(h.Name)
+		k.WriteString(": ")
+		k.WriteString(value(strings.Join(req.Header[h.Name], ","), h.Hash))
+	}
+	for _, c := range b.config.Cookies {
+		k.WriteString("\nCookie ")
+		k.WriteString(c.Name)
+		k.WriteString(": ")
+		if cookie, err := req.Cookie(c.Name); err == nil {
+			k.WriteString(value(cookie.Value, c.Hash))
+		}
+	}
+	return k.String()
+}
+
+// query returns the query parameters of the key for the raw query of a request
+func (b *Builder) query(raw string) string {
+	q := b.config.Query
+	if q == nil || raw == "" {
+		return raw
+	}
+
+	type param struct {
+		name, value string
+	}
+	var params []param
+	for _, part := range strings.FieldsFunc(raw, func(r rune) bool { return r == '&' || r == ';' }) {
+		name, value := part, ""
+		if i := strings.Index(part, "="); i >= 0 {
+			name, value = part[:i], part[i+1:]
+		}
+		// a parameter which cannot be decoded is kept as is
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+		if len(q.Include) > 0 && !matchName(q.Include, name) || matchName(q.Exclude, name) {
+			continue
+		}
+		params = append(params, param{name: name, value: value})
+	}
+	if !q.PreserveOrder {
+		// the values of a parameter keep their order, it may be meaningful
+		sort.SliceStable(params, func(i, j int) bool { return params[i].name < params[j].name })
+	}
+
+	encoded := make([]string, len(params))
+	for i, p := range params {
+		encoded[i] = url.QueryEscape(p.name) + "=" + url.QueryEscape(p.value)
+	}
+	return strings.Join(encoded, "&")
+}
+
+// matchName returns true if name is one of names, or starts with one of the names ending with "*"
+func matchName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name || strings.HasSuffix(n, "*") && strings.HasPrefix(name, strings.TrimSuffix(n, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// value returns v, or its hash if hash is true so that secrets are not stored in the keys
+func value(v string, hash bool) string {
+	if !hash || v == "" {
+		return v
+	}
+	sum := sha256.Sum256([]byte(v))
+	return "sha256:" + hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,81 @@
+package cachekey
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func request(method, target string, header ...string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Add(header[i], header[i+1])
+	}
+	return req
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		req    *http.Request
+		want   string
+	}{
+		{"raw query", Config{}, request("GET", "/items?b=2&a=1"), "GET /items?b=2&a=1"},
+		{"no query", Config{}, request("HEAD", "/items"), "HEAD /items"},
+		{"host", Config{Host: true}, request("GET", "http://Example.COM/items"), "GET example.com/items"},
+		{"sorted query", Config{Query: &Query{}}, request("GET", "/items?b=2&a=1&b=1"), "GET /items?a=1&b=2&b=1"},
+		{"preserved order", Config{Query: &Query{PreserveOrder: true}}, request("GET", "/items?b=2&a=1"), "GET /items?b=2&a=1"},
+		{"normalized encoding", Config{Query: &Query{}}, request("GET", "/items?q=a%20b;flag"), "GET /items?flag=&q=a+b"},
+		{"undecodable", Config{Query: &Query{}}, request("GET", "/items?q=%zz"), "GET /items?q=%25zz"},
+		{"include", Config{Query: &Query{Include: []string{"page", "sort*"}}},
+			request("GET", "/items?page=2&sortBy=name&lang=en"), "GET /items?page=2&sortBy=name"},
+		{"exclude", Config{Query: &Query{Exclude: []string{"utm_*", "fbclid"}}},
+			request("GET", "/items?utm_source=x&page=2&fbclid=y"), "GET /items?page=2"},
+		{"all excluded", Config{Query: &Query{Exclude: []string{"utm_*"}}},
+			request("GET", "/items?utm_source=x"), "GET /items"},
+		{"headers", Config{Headers: []Field{{Name: "accept-language"}, {Name: "X-Tenant"}}},
+			request("GET", "/items", "Accept-Language", "en", "Accept-Language", "fr"),
+			"GET /items\nAccept-Language: en,fr\nX-Tenant: "},
+		{"cookies", Config{Cookies: []Field{{Name: "session"}, {Name: "missing"}}},
+			request("GET", "/items", "Cookie", "theme=dark; session=42"),
+			"GET /items\nCookie session: 42\nCookie missing: "},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := New(test.config).Key(test.req); got != test.want {
+				t.Errorf("Key = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestKeyHashesValues(t *testing.T) {
+	b := New(Config{
+		Headers: []Field{{Name: "Authorization", Hash: true}},
+		Cookies: []Field{{Name: "session", Hash: true}},
+	})
+	key := b.Key(request("GET", "/items", "Authorization", "Bearer secret", "Cookie", "session=token"))
+	if strings.Contains(key, "secret") || strings.Contains(key, "token") {
+		t.Errorf("the key %q contains the secrets", key)
+	}
+	if !strings.Contains(key, "Authorization: sha256:") || !strings.Contains(key, "Cookie session: sha256:") {
+		t.Errorf("the key %q doesn't contain the hashes", key)
+	}
+	other := b.Key(request("GET", "/items", "Authorization", "Bearer other", "Cookie", "session=token"))
+	if other == key {
+		t.Error("different values have the same hash")
+	}
+	if got := b.Key(request("GET", "/items")); got != "GET /items\nAuthorization: \nCookie session: " {
+		t.Errorf("Key without values = %q, the empty values must not be hashed", got)
+	}
+}
+
+func TestKeyContainsPath(t *testing.T) {
+	// the method and the path are always in the key, see Config
+	b := New(Config{Host: true, Query: &Query{}, Headers: []Field{{Name: "Accept"}}})
+	if key := b.Key(request("GET", "http://example.com/items/42?lang=en", "Accept", "text/html")); !strings.Contains(key, "/items/42") {
+		t.Errorf("the key %q doesn't contain the path of the request", key)
+	}
+}
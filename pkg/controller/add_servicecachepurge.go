@@ -0,0 +1,10 @@
+package controller
+
+import (
+	"service-cache-operator/pkg/controller/servicecachepurge"
+)
+
+func init() {
+	// AddToManagerFuncs is a list of functions to create controllers and add them to a manager.
+	AddToManagerFuncs = append(AddToManagerFuncs, servicecachepurge.Add)
+}
@@ -0,0 +1,232 @@
+package rollout
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+
+	cachev1beta1 "service-cache-operator/pkg/apis/cache/v1beta1"
+	controller_utils "service-cache-operator/pkg/controller/utils"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+var log = logf.Log.WithName("controller_rollout")
+
+// revisionLabels are the labels telling the version of a pod: pod-template-hash is set by the Deployments,
+// controller-revision-hash by the StatefulSets and the DaemonSets
+var revisionLabels = []string{"pod-template-hash", "controller-revision-hash"}
+
+// Add creates a new rollout Controller and adds it to the Manager. The Manager will set fields on the Controller
+// and Start it when the Manager is Started.
+func Add(mgr manager.Manager) error {
+	return add(mgr, newReconciler(mgr))
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+	return &ReconcileRollout{client: mgr.GetClient(), scheme: mgr.GetScheme(), recorder: mgr.GetRecorder("rollout-controller")}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	// Create a new controller
+	c, err := controller.New("rollout-controller", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to primary resource ServiceCache
+	err = c.Watch(&source.Kind{Type: &cachev1beta1.ServiceCache{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to the pods behind the Services and requeue their ServiceCaches
+	err = c.Watch(&source.Kind{Type: &corev1.Pod{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(obj handler.MapObject) []reconcile.Request {
+			return serviceCachesOfPod(mgr.GetClient(), obj.Meta)
+		}),
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// serviceCachesOfPod returns the requests of the ServiceCaches invalidated on rollout whose Service selects pod
+func serviceCachesOfPod(c client.Client, pod metav1.Object) []reconcile.Request {
+	if revisionOf(pod.GetLabels()) == "" {
+		return nil
+	}
+	scs := &cachev1beta1.ServiceCacheList{}
+	if err := c.List(context.TODO(), &client.ListOptions{Namespace: pod.GetNamespace()}, scs); err != nil {
+		log.Error(err, "Failed to list the ServiceCaches", "Namespace", pod.GetNamespace())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, sc := range scs.Items {
+		if !invalidatesOnRollout(&sc) {
+			continue
+		}
+		// the Service has the name of its ServiceCache
+		svc := &corev1.Service{}
+		if err := c.Get(context.TODO(), types.NamespacedName{Name: sc.Name, Namespace: sc.Namespace}, svc); err != nil {
+			continue
+		}
+		selector := originalSelector(svc)
+		if len(selector) > 0 && labels.SelectorFromSet(selector).Matches(labels.Set(pod.GetLabels())) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: sc.Name, Namespace: sc.Namespace}})
+		}
+	}
+	return requests
+}
+
+// blank assignment to verify that ReconcileRollout implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileRollout{}
+
+// ReconcileRollout increments the cache generation of the ServiceCaches whose Service rolls out a new version
+type ReconcileRollout struct {
+	// This client, initialized using mgr.Client() above, is a split client
+	// that reads objects from the cache and writes to the apiserver
+	client client.Client
+	scheme *runtime.Scheme
+	// recorder records the events of the ServiceCaches, for the users who cannot read the logs
+	recorder record.EventRecorder
+}
+
+// Reconcile reads the versions of the ready pods behind the Service of a ServiceCache, and increments its cache
+// generation when they change. A rollout usually changes them twice, when the new pods get ready and when the old ones
+// are gone, so that the responses of the old pods cached during the rollout are not served after it either.
+// Note:
+// The Controller will requeue the Request to be processed again if the returned error is non-nil or
+// Result.Requeue is true, otherwise upon completion it will remove the work from the queue.
+func (r *ReconcileRollout) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	logger := log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
+
+	// the objects of the namespaces which are not opted in are left as they are
+	if selected, err := controller_utils.IsNamespaceSelected(request.Namespace); err != nil {
+		return reconcile.Result{}, err
+	} else if !selected {
+		return reconcile.Result{}, nil
+	}
+
+	// Fetch the ServiceCache instance
+	instance := &cachev1beta1.ServiceCache{}
+	err := r.client.Get(context.TODO(), request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Request object not found, could have been deleted after reconcile request.
+			// Return and don't requeue
+			return reconcile.Result{}, nil
+		}
+		// Error reading the object - requeue the request.
+		return reconcile.Result{}, err
+	}
+
+	status := instance.Status.DeepCopy()
+	if !invalidatesOnRollout(instance) {
+		// forget the versions, they may be outdated when the option is set again
+		status.ObservedRevisions = nil
+		return reconcile.Result{}, r.updateStatus(instance, status)
+	}
+
+	svc := &corev1.Service{}
+	err = r.client.Get(context.TODO(), request.NamespacedName, svc)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+	selector := originalSelector(svc)
+	if len(selector) == 0 {
+		return reconcile.Result{}, nil
+	}
+	pods := &corev1.PodList{}
+	opts := &client.ListOptions{Namespace: svc.Namespace, LabelSelector: labels.SelectorFromSet(selector)}
+	if err := r.client.List(context.TODO(), opts, pods); err != nil {
+		return reconcile.Result{}, err
+	}
+	revisions := readyRevisions(pods.Items)
+	if len(revisions) == 0 || reflect.DeepEqual(revisions, status.ObservedRevisions) {
+		// without ready pods, nothing new can be cached
+		return reconcile.Result{}, nil
+	}
+
+	if len(status.ObservedRevisions) > 0 {
+		status.CacheGeneration++
+		logger.Info("The pods of the Service rolled out, stop serving the cached responses",
+			"Revisions", revisions, "CacheGeneration", status.CacheGeneration)
+		r.recorder.Eventf(instance, corev1.EventTypeNormal, controller_utils.EventCacheInvalidated,
+			"The pods of the Service run the revisions %s, the responses cached before are not served anymore",
+			strings.Join(revisions, ", "))
+	}
+	status.ObservedRevisions = revisions
+	return reconcile.Result{}, r.updateStatus(instance, status)
+}
+
+// updateStatus replaces the status of sc by status, if it changed
+func (r *ReconcileRollout) updateStatus(sc *cachev1beta1.ServiceCache, status *cachev1beta1.ServiceCacheStatus) error {
+	if reflect.DeepEqual(status, &sc.Status) {
+		return nil
+	}
+	sc.Status = *status
+	return r.client.Status().Update(context.TODO(), sc)
+}
+
+// invalidatesOnRollout returns true if the cached responses of sc are invalidated when its Service rolls out
+func invalidatesOnRollout(sc *cachev1beta1.ServiceCache) bool {
+	return sc.Spec.Invalidation != nil && sc.Spec.Invalidation.Rollout
+}
+
+// originalSelector returns the selector of the pods of svc, before its traffic is routed through the cache proxy
+func originalSelector(svc *corev1.Service) map[string]string {
+	routing, err := controller_utils.GetOriginalRouting(svc)
+	if err != nil || routing == nil {
+		return svc.Spec.Selector
+	}
+	return routing.Selector
+}
+
+// readyRevisions returns the sorted versions of the ready pods
+func readyRevisions(pods []corev1.Pod) []string {
+	seen := map[string]bool{}
+	var revisions []string
+	for i := range pods {
+		pod := &pods[i]
+		revision := revisionOf(pod.Labels)
+		if revision == "" || seen[revision] || pod.DeletionTimestamp != nil || !controller_utils.IsPodReady(pod) {
+			continue
+		}
+		seen[revision] = true
+		revisions = append(revisions, revision)
+	}
+	sort.Strings(revisions)
+	return revisions
+}
+
+// revisionOf returns the version of a pod with podLabels, or "" if it's not managed by a workload controller
+func revisionOf(podLabels map[string]string) string {
+	for _, l := range revisionLabels {
+		if revision := podLabels[l]; revision != "" {
+			return revision
+		}
+	}
+	return ""
+}
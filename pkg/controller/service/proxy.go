@@ -0,0 +1,459 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	cachev1beta1 "service-cache-operator/pkg/apis/cache/v1beta1"
+	controller_utils "service-cache-operator/pkg/controller/utils"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// proxyPort is the port the cache proxy Deployment listens on
+const proxyPort = 8080
+
+func originServiceName(svc *corev1.Service) string {
+	return controller_utils.OriginServiceName(svc.Name)
+}
+
+func proxyName(svc *corev1.Service) string {
+	return controller_utils.ProxyDeploymentName(svc.Name)
+}
+
+func proxyLabels(svc *corev1.Service) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/name":        controller_utils.ProxyAppName,
+		"app.kubernetes.io/managed-by":  "service-cache-operator",
+		controller_utils.LabelOfService: svc.Name,
+	}
+}
+
+// reconcileProxy makes the traffic of svc go through the cache.
+// In proxy mode, the original pods are exposed by an origin Service, the cache proxy Deployment forwards to it, and
+// svc selects the cache proxy pods. The origin Service and the Deployment are owned by sc, so they are garbage
+// collected with it.
+// In sidecar mode, svc targets the port of the cache proxy sidecar injected into its pods by the webhook, once all its
+// ready pods have the sidecar: the pods without it would not be endpoints of svc anymore. Until then, or if the
+// operator doesn't serve the injection webhook, svc keeps its original target port.
+func (r *ReconcileService) reconcileProxy(svc *corev1.Service, sc *cachev1beta1.ServiceCache) error {
+	logger := log.WithValues("Service.Namespace", svc.Namespace, "Service.Name", svc.Name)
+
+	routing, err := controller_utils.GetOriginalRouting(svc)
+	if err != nil {
+		return err
+	}
+	if routing == nil {
+		if len(svc.Spec.Selector) == 0 || len(svc.Spec.Ports) != 1 || svc.Spec.Ports[0].Protocol == corev1.ProtocolUDP {
+			// only a Service with a selector and a single TCP port can be routed through the cache proxy
+			logger.Info("Skip routing through the cache proxy: Service must have a selector and a single TCP port")
+			return nil
+		}
+		routing = &controller_utils.OriginalRouting{
+			Selector:   svc.Spec.Selector,
+			TargetPort: svc.Spec.Ports[0].TargetPort,
+		}
+	}
+
+	if err := r.reconcilePurgeSecret(sc); err != nil {
+		return err
+	}
+	if err := r.reconcileProxyServiceAccount(sc); err != nil {
+		return err
+	}
+	if err := r.reconcileProxyRoleBinding(sc, routing); err != nil {
+		return err
+	}
+
+	var selector map[string]string
+	var targetPort intstr.IntOrString
+	switch controller_utils.ModeOf(sc) {
+	case cachev1beta1.CacheModeSidecar:
+		if err := r.deleteProxy(svc); err != nil {
+			return err
+		}
+		selector = routing.Selector
+		targetPort = routing.TargetPort
+		if !controller_utils.ControllerOptions.SidecarInjection {
+			logger.Info("Skip targeting the cache proxy sidecar: the operator doesn't serve the injection webhook")
+			break
+		}
+		injected, err := r.sidecarsInjected(svc.Namespace, routing.Selector)
+		if err != nil {
+			return err
+		}
+		if injected {
+			targetPort = intstr.FromString(controller_utils.SidecarPortName)
+		}
+	default:
+		if err := r.reconcileOriginService(svc, sc, routing); err != nil {
+			return err
+		}
+		if err := r.reconcileProxyDeployment(svc, sc); err != nil {
+			return err
+		}
+		selector = proxyLabels(svc)
+		targetPort = intstr.FromInt(proxyPort)
+	}
+
+	// finally send the traffic of the Service to the cache proxy
+	if _, ok := svc.Annotations[controller_utils.KeyOfOriginalRouting]; ok &&
+		reflect.DeepEqual(svc.Spec.Selector, selector) && svc.Spec.Ports[0].TargetPort == targetPort {
+		return nil
+	}
+	if err := controller_utils.SetOriginalRouting(svc, routing); err != nil {
+		return err
+	}
+	svc.Spec.Selector = selector
+	svc.Spec.Ports[0].TargetPort = targetPort
+	logger.Info("Route the traffic of the Service through the cache proxy", "Mode", controller_utils.ModeOf(sc))
+	if err := r.client.Update(context.TODO(), svc); err != nil {
+		return err
+	}
+	r.recorder.Eventf(svc, corev1.EventTypeNormal, controller_utils.EventProxyRouted,
+		"Routed the traffic of the Service through the cache proxy in %s mode", controller_utils.ModeOf(sc))
+	return nil
+}
+
+// sidecarServicesOfPod returns the requests of the Services in sidecar mode selecting pod
+func sidecarServicesOfPod(c client.Client, pod metav1.Object) []reconcile.Request {
+	svcs := &corev1.ServiceList{}
+	if err := c.List(context.TODO(), &client.ListOptions{Namespace: pod.GetNamespace()}, svcs); err != nil {
+		log.Error(err, "Failed to list the Services", "Namespace", pod.GetNamespace())
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range svcs.Items {
+		svc := &svcs.Items[i]
+		if cachev1beta1.CacheMode(strings.TrimSpace(svc.Annotations[controller_utils.KeyOfMode])) != cachev1beta1.CacheModeSidecar {
+			continue
+		}
+		routing, err := controller_utils.GetOriginalRouting(svc)
+		if err != nil || routing == nil || len(routing.Selector) == 0 {
+			continue
+		}
+		if labels.SelectorFromSet(routing.Selector).Matches(labels.Set(pod.GetLabels())) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}})
+		}
+	}
+	return requests
+}
+
+// sidecarsInjected returns true if the ready pods selected by selector in namespace all have the cache proxy sidecar,
+// and there's at least one
+func (r *ReconcileService) sidecarsInjected(namespace string, selector map[string]string) (bool, error) {
+	pods := &corev1.PodList{}
+	opts := &client.ListOptions{Namespace: namespace, LabelSelector: labels.SelectorFromSet(selector)}
+	if err := r.client.List(context.TODO(), opts, pods); err != nil {
+		return false, err
+	}
+	ready := 0
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil || !controller_utils.IsPodReady(pod) {
+			continue
+		}
+		if !controller_utils.HasSidecar(pod) {
+			return false, nil
+		}
+		ready++
+	}
+	return ready > 0, nil
+}
+
+// deleteProxy deletes the origin Service and the cache proxy Deployment of svc, if they exist
+func (r *ReconcileService) deleteProxy(svc *corev1.Service) error {
+	objects := []runtime.Object{
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: proxyName(svc), Namespace: svc.Namespace}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: originServiceName(svc), Namespace: svc.Namespace}},
+	}
+	for _, obj := range objects {
+		if err := r.client.Delete(context.TODO(), obj); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// reconcileOriginService creates or updates the Service exposing the original pods of svc
+func (r *ReconcileService) reconcileOriginService(svc *corev1.Service, sc *cachev1beta1.ServiceCache, routing *controller_utils.OriginalRouting) error {
+	port := svc.Spec.Ports[0]
+	ports := []corev1.ServicePort{{
+		Name:       port.Name,
+		Protocol:   port.Protocol,
+		Port:       port.Port,
+		TargetPort: routing.TargetPort,
+	}}
+
+	found := &corev1.Service{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: originServiceName(svc), Namespace: svc.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		origin := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      originServiceName(svc),
+				Namespace: svc.Namespace,
+				Labels:    map[string]string{controller_utils.LabelOfService: svc.Name},
+			},
+			Spec: corev1.ServiceSpec{
+				Selector: routing.Selector,
+				Ports:    ports,
+			},
+		}
+		if err := controllerutil.SetControllerReference(sc, origin, r.scheme); err != nil {
+			return err
+		}
+		log.Info("Creating the origin Service", "Service.Namespace", origin.Namespace, "Service.Name", origin.Name)
+		return r.client.Create(context.TODO(), origin)
+	}
+	if err != nil {
+		return err
+	}
+
+	if reflect.DeepEqual(found.Spec.Selector, routing.Selector) && len(found.Spec.Ports) == 1 &&
+		found.Spec.Ports[0].Port == port.Port && found.Spec.Ports[0].TargetPort == routing.TargetPort {
+		return nil
+	}
+	found.Spec.Selector = routing.Selector
+	found.Spec.Ports = ports
+	return r.client.Update(context.TODO(), found)
+}
+
+// reconcilePurgeSecret creates the Secret holding the random token of the purge endpoints of the cache proxies of sc.
+// The token is never changed, the Secret is owned by sc so it's deleted with it.
+func (r *ReconcileService) reconcilePurgeSecret(sc *cachev1beta1.ServiceCache) error {
+	found := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: controller_utils.PurgeSecretName(sc), Namespace: sc.Namespace}, found)
+	if err == nil || !errors.IsNotFound(err) {
+		return err
+	}
+
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      controller_utils.PurgeSecretName(sc),
+			Namespace: sc.Namespace,
+			Labels:    map[string]string{controller_utils.LabelOfService: sc.Name},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{controller_utils.PurgeTokenKey: []byte(hex.EncodeToString(token))},
+	}
+	if err := controllerutil.SetControllerReference(sc, secret, r.scheme); err != nil {
+		return err
+	}
+	log.Info("Creating the purge token Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+	return r.client.Create(context.TODO(), secret)
+}
+
+// reconcileProxyServiceAccount creates the ServiceAccount of the cache proxies in the namespace of sc. It's shared by
+// the ServiceCaches of the namespace, each one owning it, so it's deleted with the last one. A ServiceAccount which
+// wasn't created by the operator is left as is.
+func (r *ReconcileService) reconcileProxyServiceAccount(sc *cachev1beta1.ServiceCache) error {
+	owner := metav1.OwnerReference{
+		APIVersion: cachev1beta1.SchemeGroupVersion.String(),
+		Kind:       "ServiceCache",
+		Name:       sc.Name,
+		UID:        sc.UID,
+	}
+	found := &corev1.ServiceAccount{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: controller_utils.ProxyServiceAccountName, Namespace: sc.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		sa := &corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            controller_utils.ProxyServiceAccountName,
+				Namespace:       sc.Namespace,
+				Labels:          map[string]string{"app.kubernetes.io/managed-by": "service-cache-operator"},
+				OwnerReferences: []metav1.OwnerReference{owner},
+			},
+		}
+		log.Info("Creating the cache proxy ServiceAccount", "ServiceAccount.Namespace", sa.Namespace, "ServiceAccount.Name", sa.Name)
+		return r.client.Create(context.TODO(), sa)
+	}
+	if err != nil {
+		return err
+	}
+
+	if found.Labels["app.kubernetes.io/managed-by"] != "service-cache-operator" {
+		return nil
+	}
+	for _, ref := range found.OwnerReferences {
+		if ref.UID == sc.UID {
+			return nil
+		}
+	}
+	found.OwnerReferences = append(found.OwnerReferences, owner)
+	return r.client.Update(context.TODO(), found)
+}
+
+// reconcileProxyRoleBinding creates or updates the RoleBinding letting the cache proxies of sc read it, owned by sc. In
+// sidecar mode, the sidecars read it with the token of their pod: the ServiceAccounts of the pods selected by the
+// Service are bound too.
+func (r *ReconcileService) reconcileProxyRoleBinding(sc *cachev1beta1.ServiceCache, routing *controller_utils.OriginalRouting) error {
+	accounts := []string{controller_utils.ProxyServiceAccountName}
+	if controller_utils.ModeOf(sc) == cachev1beta1.CacheModeSidecar {
+		podAccounts, err := r.podServiceAccounts(sc.Namespace, routing.Selector)
+		if err != nil {
+			return err
+		}
+		accounts = append(accounts, podAccounts...)
+	}
+	subjects := make([]rbacv1.Subject, 0, len(accounts))
+	for _, name := range accounts {
+		subjects = append(subjects, rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Name: name, Namespace: sc.Namespace})
+	}
+
+	found := &rbacv1.RoleBinding{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: controller_utils.ProxyRoleBindingName(sc), Namespace: sc.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		binding := &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      controller_utils.ProxyRoleBindingName(sc),
+				Namespace: sc.Namespace,
+				Labels:    map[string]string{controller_utils.LabelOfService: sc.Name},
+			},
+			Subjects: subjects,
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "ClusterRole",
+				Name:     controller_utils.ProxyClusterRoleName,
+			},
+		}
+		if err := controllerutil.SetControllerReference(sc, binding, r.scheme); err != nil {
+			return err
+		}
+		log.Info("Creating the cache proxy RoleBinding", "RoleBinding.Namespace", binding.Namespace, "RoleBinding.Name", binding.Name)
+		return r.client.Create(context.TODO(), binding)
+	}
+	if err != nil {
+		return err
+	}
+
+	if reflect.DeepEqual(found.Subjects, subjects) {
+		return nil
+	}
+	found.Subjects = subjects
+	return r.client.Update(context.TODO(), found)
+}
+
+// podServiceAccounts returns the sorted ServiceAccounts of the pods selected by selector in namespace, other than the
+// one of the cache proxy
+func (r *ReconcileService) podServiceAccounts(namespace string, selector map[string]string) ([]string, error) {
+	pods := &corev1.PodList{}
+	opts := &client.ListOptions{Namespace: namespace, LabelSelector: labels.SelectorFromSet(selector)}
+	if err := r.client.List(context.TODO(), opts, pods); err != nil {
+		return nil, err
+	}
+	accounts := sets.NewString()
+	for _, pod := range pods.Items {
+		name := pod.Spec.ServiceAccountName
+		if name == "" {
+			name = "default"
+		}
+		if name != controller_utils.ProxyServiceAccountName {
+			accounts.Insert(name)
+		}
+	}
+	return accounts.List(), nil
+}
+
+// reconcileProxyDeployment creates or updates the Deployment of the cache proxy serving svc
+func (r *ReconcileService) reconcileProxyDeployment(svc *corev1.Service, sc *cachev1beta1.ServiceCache) error {
+	image := os.Getenv(controller_utils.ProxyImageEnvVar)
+	if image == "" {
+		return fmt.Errorf("%s must be set to deploy the cache proxy", controller_utils.ProxyImageEnvVar)
+	}
+	upstream := fmt.Sprintf("http://%s.%s.svc:%d", originServiceName(svc), svc.Namespace, svc.Spec.Ports[0].Port)
+	args := controller_utils.ProxyArgs(proxyPort, controller_utils.ProxyAdminPort, upstream, svc)
+	// the API version of the field is set as the API server defaults it, so that the env of the Deployment compares equal
+	env := controller_utils.ProxyEnv(sc, corev1.EnvVar{
+		Name:      "POD_NAMESPACE",
+		ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{APIVersion: "v1", FieldPath: "metadata.namespace"}},
+	})
+
+	found := &appsv1.Deployment{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: proxyName(svc), Namespace: svc.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		deployment := newProxyDeployment(svc, image, args, env)
+		if err := controllerutil.SetControllerReference(sc, deployment, r.scheme); err != nil {
+			return err
+		}
+		log.Info("Creating the cache proxy Deployment", "Deployment.Namespace", deployment.Namespace, "Deployment.Name", deployment.Name)
+		return r.client.Create(context.TODO(), deployment)
+	}
+	if err != nil {
+		return err
+	}
+
+	// the API server defaults some fields of the pod template, so only the fields set by the operator are compared
+	containers := found.Spec.Template.Spec.Containers
+	if len(containers) > 0 && containers[0].Image == image && reflect.DeepEqual(containers[0].Args, args) &&
+		reflect.DeepEqual(containers[0].Env, env) && len(found.Spec.Template.Spec.Volumes) > 0 {
+		return nil
+	}
+	found.Spec.Template.Spec = newProxyDeployment(svc, image, args, env).Spec.Template.Spec
+	return r.client.Update(context.TODO(), found)
+}
+
+func newProxyDeployment(svc *corev1.Service, image string, args []string, env []corev1.EnvVar) *appsv1.Deployment {
+	labels := proxyLabels(svc)
+	replicas := int32(1)
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      proxyName(svc),
+			Namespace: svc.Namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: controller_utils.ProxyServiceAccountName,
+					Containers: []corev1.Container{{
+						Name:    controller_utils.ProxyContainerName,
+						Image:   image,
+						Command: []string{"service-cache-proxy"},
+						Args:    args,
+						Env:     env,
+						Ports: []corev1.ContainerPort{{
+							Name:          "http",
+							ContainerPort: proxyPort,
+							Protocol:      corev1.ProtocolTCP,
+						}, {
+							Name:          controller_utils.ProxyAdminPortName,
+							ContainerPort: controller_utils.ProxyAdminPort,
+							Protocol:      corev1.ProtocolTCP,
+						}},
+						VolumeMounts: []corev1.VolumeMount{controller_utils.ProxyCacheVolumeMount()},
+						ReadinessProbe: &corev1.Probe{
+							Handler: corev1.Handler{
+								TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(proxyPort)},
+							},
+						},
+					}},
+					Volumes: []corev1.Volume{controller_utils.ProxyCacheVolume()},
+				},
+			},
+		},
+	}
+}
@@ -4,17 +4,19 @@ import (
 	"context"
 	"strings"
 
-	cachev1alpha1 "service-cache-operator/pkg/apis/cache/v1alpha1"
+	cachev1beta1 "service-cache-operator/pkg/apis/cache/v1beta1"
 	controller_utils "service-cache-operator/pkg/controller/utils"
 
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -24,6 +26,9 @@ import (
 
 var log = logf.Log.WithName("controller_service")
 
+// controllerName is the name of the controller, in its events and metrics
+const controllerName = "service-controller"
+
 // Add creates a new Service Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
 func Add(mgr manager.Manager) error {
@@ -32,13 +37,13 @@ func Add(mgr manager.Manager) error {
 
 // newReconciler returns a new reconcile.Reconciler
 func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcileService{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+	return &ReconcileService{client: mgr.GetClient(), scheme: mgr.GetScheme(), recorder: mgr.GetRecorder(controllerName)}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
 func add(mgr manager.Manager, r reconcile.Reconciler) error {
 	// Create a new controller
-	c, err := controller.New("service-controller", mgr, controller.Options{Reconciler: r})
+	c, err := controller.New(controllerName, mgr, controller.Options{Reconciler: r})
 	if err != nil {
 		return err
 	}
@@ -49,10 +54,36 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
-	// Watch for changes to secondary resource Pods and requeue the owner Service
-	err = c.Watch(&source.Kind{Type: &cachev1alpha1.ServiceCache{}}, &handler.EnqueueRequestForOwner{
+	// Watch for changes to the ServiceCaches and requeue the Service, which has the name of the ServiceCache.
+	// The Service doesn't own its ServiceCache, see controller_utils.LabelOfService.
+	err = c.Watch(&source.Kind{Type: &cachev1beta1.ServiceCache{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to the cache proxy Deployments and requeue the Service, which has the name of the owner ServiceCache
+	err = c.Watch(&source.Kind{Type: &appsv1.Deployment{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &cachev1beta1.ServiceCache{},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to the RoleBindings of the cache proxies and requeue the Service, as for the Deployments
+	err = c.Watch(&source.Kind{Type: &rbacv1.RoleBinding{}}, &handler.EnqueueRequestForOwner{
 		IsController: true,
-		OwnerType:    &corev1.Service{},
+		OwnerType:    &cachev1beta1.ServiceCache{},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to the pods behind the Services in sidecar mode, which target the sidecars once they all have one
+	err = c.Watch(&source.Kind{Type: &corev1.Pod{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(obj handler.MapObject) []reconcile.Request {
+			return sidecarServicesOfPod(mgr.GetClient(), obj.Meta)
+		}),
 	})
 	if err != nil {
 		return err
@@ -70,6 +101,8 @@ type ReconcileService struct {
 	// that reads objects from the cache and writes to the apiserver
 	client client.Client
 	scheme *runtime.Scheme
+	// recorder records the events of the Services and their ServiceCaches, for the users who cannot read the logs
+	recorder record.EventRecorder
 }
 
 // Reconcile reads that state of the cluster for a Service object and makes changes based on the state read
@@ -81,6 +114,13 @@ func (r *ReconcileService) Reconcile(request reconcile.Request) (reconcile.Resul
 	logger := log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
 	logger.Info("Reconciling Service")
 
+	// the objects of the namespaces which are not opted in are left as they are
+	if selected, err := controller_utils.IsNamespaceSelected(request.Namespace); err != nil {
+		return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonRead, err)
+	} else if !selected {
+		return reconcile.Result{}, nil
+	}
+
 	// Fetch the Service instance
 	instance := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta {
@@ -94,34 +134,80 @@ func (r *ReconcileService) Reconcile(request reconcile.Request) (reconcile.Resul
 		if errors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
 			logger.Info("The Service is not found, perhaps it's deleted already.")
-			if errOfServiceCache == nil {
+			if errOfServiceCache == nil && serviceCache.DeletionTimestamp == nil {
 				logger.Info("The Service is not found, but found its related ServiceCache so delete it.")
-				r.client.Delete(context.TODO(), serviceCache)
+				if err := r.client.Delete(context.TODO(), serviceCache); err == nil {
+					controller_utils.OrphansDeletedTotal.WithLabelValues(controllerName).Inc()
+				}
+				r.recorder.Event(serviceCache, corev1.EventTypeNormal, controller_utils.EventServiceCacheDeletedOrphan,
+					"Deleted the ServiceCache since its Service doesn't exist")
 			}
 			// Return and don't requeue
 			return reconcile.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
 		logger.Error(err, "The Service cannot be read")
-		return reconcile.Result{}, err
+		return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonRead, err)
+	}
+
+	if instance.DeletionTimestamp != nil {
+		// delete the ServiceCache with the Service, the finalizer of the ServiceCache deletes the cache proxy
+		if err := r.finalize(instance, serviceCache, errOfServiceCache); err != nil {
+			logger.Error(err, "Failed to delete the ServiceCache of the deleted Service")
+			return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonSync, err)
+		}
+		return reconcile.Result{}, nil
 	}
 
 	// if service is not annotated, then skip; Furthermore, if the ServiceCache object for the service is found, remove it.
-	if !isAnnotated(instance) {
-		if errOfServiceCache == nil && serviceCache != nil {
+	if !controller_utils.IsAnnotated(instance) {
+		if errOfServiceCache == nil && controller_utils.ControllerOptions.SourceOfTruth == controller_utils.SourceOfTruthCRD {
+			// the ServiceCache holds the configuration, its reconciler writes the annotations back
+			logger.Info("Service is not annotated but its ServiceCache is the source of truth, so keep it")
+			return reconcile.Result{}, nil
+		}
+		// send the traffic back to the original pods before the cache proxy is garbage collected with the ServiceCache
+		restored, err := controller_utils.RestoreServiceRouting(instance)
+		if err != nil {
+			logger.Error(err, "Failed to read the original routing of the Service")
+			return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonRouting, err)
+		}
+		// the Service is not cached anymore, nothing is left to clean up
+		released := controller_utils.RemoveFinalizer(instance, controller_utils.FinalizerCleanup)
+		if restored || released {
+			if err := r.client.Update(context.TODO(), instance); err != nil {
+				return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonRouting, err)
+			}
+		}
+		if restored {
+			logger.Info("Service is not annotated anymore, so restore its original routing")
+			r.recorder.Event(instance, corev1.EventTypeNormal, controller_utils.EventRoutingRestored,
+				"Restored the original selector since the Service is not annotated anymore")
+		}
+		if errOfServiceCache == nil && serviceCache != nil && serviceCache.DeletionTimestamp == nil {
 			logger.Info("Service is not annotated but found its ServiceCache, so remove this ServiceCache",
 			  "ServiceCache.Namespace", serviceCache.Namespace, "ServiceCache.Name", serviceCache.Name)
 			r.client.Delete(context.TODO(), serviceCache)
+			r.recorder.Event(instance, corev1.EventTypeNormal, controller_utils.EventServiceCacheDeleted,
+				"Deleted the ServiceCache since the Service is not annotated anymore")
 		}
 		// The service is not annotated by service cache annotations, so return and don't requeue
 		logger.Info("Skip reconcile: Service is not annotated so it's not our target")
 		return reconcile.Result{}, nil
 	}
 
-	if !validateService(instance) {
+	if err := validateService(instance); err != nil {
 		// FIXME: find a better way to warn user
-		logger.Info("The configuration in Service object is correct, so remove it")
-		// r.client.Delete(context.TODO(), instance)
+		logger.Info("The configuration in Service object is not correct", "Reason", err.Error())
+		controller_utils.ValidationFailuresTotal.WithLabelValues(controllerName).Inc()
+		r.recorder.Eventf(instance, corev1.EventTypeWarning, controller_utils.EventInvalidConfiguration,
+			"The service cache annotations are invalid: %v", err)
+		if errOfServiceCache == nil {
+			if err := r.updateStatus(instance, serviceCache, err, nil); err != nil {
+				logger.Error(err, "Failed to update the status of the ServiceCache")
+				return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonStatus, err)
+			}
+		}
 		return reconcile.Result{}, nil
 	}
 
@@ -130,25 +216,74 @@ func (r *ReconcileService) Reconcile(request reconcile.Request) (reconcile.Resul
 		if errors.IsNotFound(errOfServiceCache) {
 			logger.Error(errOfServiceCache, "Failed to find the related ServiceCache: so create one")
 			serviceCache, errOfServiceCache = r.createServiceCache(instance)
+			if errOfServiceCache != nil {
+				return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonCreate, errOfServiceCache)
+			}
+			r.recorder.Eventf(instance, corev1.EventTypeNormal, controller_utils.EventServiceCacheCreated,
+				"Created the ServiceCache %s", serviceCache.Name)
+			controller_utils.SyncsTotal.WithLabelValues(controllerName, controller_utils.DirectionToServiceCache).Inc()
+			return reconcile.Result{}, nil
 		}
-		return reconcile.Result{}, errOfServiceCache
+		return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonRead, errOfServiceCache)
 	}
-
-	hasDiff := controller_utils.DiffServiceAndServiceCache(instance, serviceCache)
-	if !hasDiff {
-		logger.Info("Configuration between Service and its ServiceCache has no difference")
+	if serviceCache.DeletionTimestamp != nil {
+		// the finalizer of the ServiceCache is restoring the Service
+		logger.Info("The ServiceCache is being deleted, so don't sync it")
 		return reconcile.Result{}, nil
 	}
 
-	// update service cache based on service's configuration
-	r.syncServiceToServiceCache(instance, serviceCache)
-	r.client.Update(context.TODO(), serviceCache)
-	logger.Info("Configuration has been synced ServiceCache from Service")
+	// make sure the ServiceCache is deleted, and the cache proxy with it, when the Service is deleted
+	if controller_utils.AddFinalizer(instance, controller_utils.FinalizerCleanup) {
+		if err := r.client.Update(context.TODO(), instance); err != nil {
+			logger.Error(err, "Failed to add the finalizer of the Service")
+			return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonSync, err)
+		}
+	}
+
+	// route the traffic of the Service through the cache proxy
+	if err := r.reconcileProxy(instance, serviceCache); err != nil {
+		logger.Error(err, "Failed to route the Service through the cache proxy")
+		r.recorder.Eventf(instance, corev1.EventTypeWarning, controller_utils.EventProxyFailed,
+			"Failed to route the Service through the cache proxy: %v", err)
+		return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonProxy, err)
+	}
+
+	plan := controller_utils.PlanSync(controller_utils.ControllerOptions.SourceOfTruth, instance, serviceCache)
+	controller_utils.RecordDiffs(controllerName, plan)
+	if len(plan.Conflicts) > 0 {
+		logger.Info("Configuration has been changed on both the Service and its ServiceCache, so don't sync it", "Fields", plan.Conflicts)
+		r.recorder.Eventf(instance, corev1.EventTypeWarning, controller_utils.EventSyncConflict,
+			"The fields %s have been changed on both the Service and its ServiceCache, they are not synced",
+			strings.Join(plan.Conflicts, ", "))
+	}
+	if len(plan.ToServiceCache) > 0 {
+		// update service cache based on service's configuration
+		r.syncServiceToServiceCache(instance, serviceCache, plan.ToServiceCache)
+		if err := r.client.Update(context.TODO(), serviceCache); err != nil {
+			logger.Error(err, "Failed to update the ServiceCache")
+			r.recorder.Eventf(instance, corev1.EventTypeWarning, controller_utils.EventSyncFailed,
+				"Failed to update the ServiceCache from the annotations: %v", err)
+			return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonSync, err)
+		}
+		logger.Info("Configuration has been synced ServiceCache from Service", "Fields", plan.ToServiceCache)
+		controller_utils.SyncsTotal.WithLabelValues(controllerName, controller_utils.DirectionToServiceCache).Inc()
+		r.recorder.Eventf(serviceCache, corev1.EventTypeNormal, controller_utils.EventServiceCacheSynced,
+			"Updated %s of the ServiceCache from the annotations of its Service", strings.Join(plan.ToServiceCache, ", "))
+	} else {
+		logger.Info("No configuration to sync from the Service to its ServiceCache")
+	}
+
+	// remember the fields in sync, to tell which side changes them next
+	if controller_utils.RecordLastSynced(instance, serviceCache) {
+		if err := r.client.Update(context.TODO(), instance); err != nil {
+			logger.Error(err, "Failed to record the configuration in sync in the Service")
+			return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonSync, err)
+		}
+	}
 
-	// Set Service instance as the owner and controller
-	if err := controllerutil.SetControllerReference(instance, serviceCache, r.scheme); err != nil {
-		logger.Error(err, "Failed to call SetControllerReference()")
-		return reconcile.Result{}, err
+	if err := r.updateStatus(instance, serviceCache, nil, plan.Conflicts); err != nil {
+		logger.Error(err, "Failed to update the status of the ServiceCache")
+		return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonStatus, err)
 	}
 
 	// Service Cache object is up to date now, so don't requeue
@@ -156,9 +291,28 @@ func (r *ReconcileService) Reconcile(request reconcile.Request) (reconcile.Resul
 	return reconcile.Result{}, nil
 }
 
+// finalize deletes the ServiceCache of the deleted Service svc, if any, then releases the finalizer of svc
+func (r *ReconcileService) finalize(svc *corev1.Service, sc *cachev1beta1.ServiceCache, errOfServiceCache error) error {
+	if !controller_utils.HasFinalizer(svc, controller_utils.FinalizerCleanup) {
+		return nil
+	}
+	if errOfServiceCache != nil && !errors.IsNotFound(errOfServiceCache) {
+		return errOfServiceCache
+	}
+	if errOfServiceCache == nil && sc.DeletionTimestamp == nil {
+		if err := r.client.Delete(context.TODO(), sc); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		r.recorder.Event(sc, corev1.EventTypeNormal, controller_utils.EventServiceCacheDeleted,
+			"Deleted the ServiceCache since its Service is deleted")
+	}
+	controller_utils.RemoveFinalizer(svc, controller_utils.FinalizerCleanup)
+	return r.client.Update(context.TODO(), svc)
+}
+
 // findServiceCache returns a ServiceCache object or nil
-func (r *ReconcileService) findServiceCache(svc *corev1.Service) (*cachev1alpha1.ServiceCache, error) {
-	found := &cachev1alpha1.ServiceCache{
+func (r *ReconcileService) findServiceCache(svc *corev1.Service) (*cachev1beta1.ServiceCache, error) {
+	found := &cachev1beta1.ServiceCache{
 		ObjectMeta: metav1.ObjectMeta {
 			Name:      svc.Name,
 			Namespace: svc.Namespace,
@@ -172,40 +326,47 @@ func (r *ReconcileService) findServiceCache(svc *corev1.Service) (*cachev1alpha1
 }
 
 // createServiceCache returns a ServiceCache object
-func (r *ReconcileService) createServiceCache(svc *corev1.Service) (*cachev1alpha1.ServiceCache, error) {
-	sc := &cachev1alpha1.ServiceCache {
+func (r *ReconcileService) createServiceCache(svc *corev1.Service) (*cachev1beta1.ServiceCache, error) {
+	sc := &cachev1beta1.ServiceCache {
 		ObjectMeta: metav1.ObjectMeta {
 			Name:      svc.Name,
 			Namespace: svc.Namespace,
 		},
-		Spec: cachev1alpha1.ServiceCacheSpec {
+		Spec: cachev1beta1.ServiceCacheSpec {
 			CacheableByDefault: false,
 			URLs: nil,
 		},
 	}
-	r.syncServiceToServiceCache(svc, sc)
+	r.syncServiceToServiceCache(svc, sc, controller_utils.ConfigFields)
+	// restore the Service when the ServiceCache is deleted
+	controller_utils.LinkToService(sc)
 	err := r.client.Create(context.TODO(), sc)
 
 	return sc, err
 }
 
-func (r *ReconcileService) syncServiceToServiceCache(svc *corev1.Service, serviceCache *cachev1alpha1.ServiceCache) {
-	serviceCache.Spec.CacheableByDefault = (svc.Annotations[controller_utils.KeyOfCacheableByDefault] == "true")
-	urls := svc.Annotations[controller_utils.KeyOfCacheableUrls]
-	urls = strings.TrimSuffix(strings.TrimPrefix(urls, "["), "]")
-	serviceCache.Spec.URLs = strings.Split(urls, ",")
-}
-
-func isAnnotated(svc *corev1.Service) bool {
-	for k := range svc.Annotations {
-		if strings.HasPrefix(k, controller_utils.KeyPrefix) {
-			return true
+// syncServiceToServiceCache copies fields from the annotations of svc to serviceCache
+func (r *ReconcileService) syncServiceToServiceCache(svc *corev1.Service, serviceCache *cachev1beta1.ServiceCache, fields []string) {
+	for _, f := range fields {
+		switch f {
+		case controller_utils.FieldCacheableByDefault:
+			serviceCache.Spec.CacheableByDefault = (strings.TrimSpace(svc.Annotations[controller_utils.KeyOfCacheableByDefault]) == "true")
+		case controller_utils.FieldURLs:
+			serviceCache.Spec.URLs = controller_utils.ParseURLs(svc.Annotations[controller_utils.KeyOfCacheableUrls])
+		case controller_utils.FieldMode:
+			serviceCache.Spec.Mode = cachev1beta1.CacheMode(strings.TrimSpace(svc.Annotations[controller_utils.KeyOfMode]))
+		case controller_utils.FieldRules:
+			// the rules have been validated by validateService
+			serviceCache.Spec.Rules, _ = controller_utils.ParseRules(svc.Annotations[controller_utils.KeyOfRules])
+		case controller_utils.FieldStaleWhileRevalidate:
+			serviceCache.Spec.StaleWhileRevalidate, _ = controller_utils.ParseDuration(svc.Annotations[controller_utils.KeyOfStaleWhileRevalidate])
+		case controller_utils.FieldStaleIfError:
+			serviceCache.Spec.StaleIfError, _ = controller_utils.ParseDuration(svc.Annotations[controller_utils.KeyOfStaleIfError])
 		}
 	}
-	return false
 }
 
-func validateService(svc *corev1.Service) bool {
-	//TODO: validate configurations in Service object
-  return true
+// validateService returns an error describing why the configuration in svc is rejected, or nil
+func validateService(svc *corev1.Service) error {
+	return controller_utils.ValidateServiceAnnotations(svc.Annotations).ToAggregate()
 }
\ No newline at end of file
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"reflect"
+
+	cachev1beta1 "service-cache-operator/pkg/apis/cache/v1beta1"
+	controller_utils "service-cache-operator/pkg/controller/utils"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// updateStatus writes the state of the cache of svc in the status of sc.
+// invalid is the reason why the configuration of svc is rejected, or nil if it's valid.
+// conflicts are the fields changed on both svc and sc, which are not synced.
+func (r *ReconcileService) updateStatus(svc *corev1.Service, sc *cachev1beta1.ServiceCache, invalid error, conflicts []string) error {
+	status := sc.Status.DeepCopy()
+	status.ObservedGeneration = sc.Generation
+	controller_utils.SetInvalidCondition(status, "InvalidService", invalid)
+	if invalid == nil {
+		controller_utils.SetSyncedStatus(status, svc, sc, conflicts)
+		proxyStatus, reason, message, err := r.proxyCondition(svc, sc)
+		if err != nil {
+			return err
+		}
+		controller_utils.SetCondition(status, cachev1beta1.ConditionProxyAvailable, proxyStatus, reason, message)
+	}
+	controller_utils.SetReadyCondition(status)
+
+	if reflect.DeepEqual(status, &sc.Status) {
+		return nil
+	}
+	sc.Status = *status
+	return r.client.Status().Update(context.TODO(), sc)
+}
+
+// proxyCondition returns the ProxyAvailable condition of sc
+func (r *ReconcileService) proxyCondition(svc *corev1.Service, sc *cachev1beta1.ServiceCache) (corev1.ConditionStatus, string, string, error) {
+	if _, ok := svc.Annotations[controller_utils.KeyOfOriginalRouting]; !ok {
+		return corev1.ConditionFalse, "NotRouted",
+			"The traffic of the Service doesn't go through the cache proxy: Service must have a selector and a single TCP port", nil
+	}
+	if controller_utils.ModeOf(sc) == cachev1beta1.CacheModeSidecar {
+		if !controller_utils.ControllerOptions.SidecarInjection {
+			return corev1.ConditionFalse, "SidecarInjectionDisabled",
+				"The sidecar mode requires the operator to serve the injection webhook, with --enable-webhooks: " +
+					"the traffic of the Service goes to its pods directly", nil
+		}
+		if svc.Spec.Ports[0].TargetPort != intstr.FromString(controller_utils.SidecarPortName) {
+			return corev1.ConditionFalse, "SidecarNotInjected",
+				"Not all the ready pods of the Service have the cache proxy sidecar, the traffic goes to them directly: " +
+					"restart the pods created before the sidecar mode or while the injection webhook was unavailable", nil
+		}
+		return corev1.ConditionTrue, "Sidecar", "The cache proxy runs as a sidecar of the pods of the Service", nil
+	}
+
+	deployment := &appsv1.Deployment{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: proxyName(svc), Namespace: svc.Namespace}, deployment)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return corev1.ConditionFalse, "DeploymentNotFound", "The cache proxy Deployment is not created yet", nil
+		}
+		return corev1.ConditionUnknown, "", "", err
+	}
+	if deployment.Status.AvailableReplicas == 0 {
+		return corev1.ConditionFalse, "DeploymentUnavailable", "The cache proxy Deployment has no available replica", nil
+	}
+	return corev1.ConditionTrue, "DeploymentAvailable", "The cache proxy Deployment is available", nil
+}
@@ -2,20 +2,23 @@ package servicecache
 
 import (
 	"context"
+	"reflect"
 	"strconv"
 	"strings"
 
-	cachev1alpha1 "service-cache-operator/pkg/apis/cache/v1alpha1"
+	cachev1beta1 "service-cache-operator/pkg/apis/cache/v1beta1"
 	controller_utils "service-cache-operator/pkg/controller/utils"
 
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/record"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -25,6 +28,9 @@ import (
 
 var log = logf.Log.WithName("controller_servicecache")
 
+// controllerName is the name of the controller, in its events and metrics
+const controllerName = "servicecache-controller"
+
 // Add creates a new ServiceCache Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
 func Add(mgr manager.Manager) error {
@@ -33,27 +39,32 @@ func Add(mgr manager.Manager) error {
 
 // newReconciler returns a new reconcile.Reconciler
 func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcileServiceCache{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+	return &ReconcileServiceCache{client: mgr.GetClient(), scheme: mgr.GetScheme(), recorder: mgr.GetRecorder(controllerName)}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
 func add(mgr manager.Manager, r reconcile.Reconciler) error {
 	// Create a new controller
-	c, err := controller.New("servicecache-controller", mgr, controller.Options{Reconciler: r})
+	c, err := controller.New(controllerName, mgr, controller.Options{Reconciler: r})
 	if err != nil {
 		return err
 	}
 
 	// Watch for changes to primary resource ServiceCache
-	err = c.Watch(&source.Kind{Type: &cachev1alpha1.ServiceCache{}}, &handler.EnqueueRequestForObject{})
+	err = c.Watch(&source.Kind{Type: &cachev1beta1.ServiceCache{}}, &handler.EnqueueRequestForObject{})
 	if err != nil {
 		return err
 	}
 
-	// Watch for changes to secondary resource Services and requeue the owner ServiceCache
-	err = c.Watch(&source.Kind{Type: &corev1.Service{}}, &handler.EnqueueRequestForOwner{
-		IsController: true,
-		OwnerType:    &cachev1alpha1.ServiceCache{},
+	// Watch for changes to the Services linked to a ServiceCache and requeue the ServiceCache, which has the name of
+	// the Service. The ServiceCache doesn't own its Service, see controller_utils.LabelOfService.
+	err = c.Watch(&source.Kind{Type: &corev1.Service{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(obj handler.MapObject) []reconcile.Request {
+			if !controller_utils.HasFinalizer(obj.Meta, controller_utils.FinalizerCleanup) {
+				return nil
+			}
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: obj.Meta.GetName(), Namespace: obj.Meta.GetNamespace()}}}
+		}),
 	})
 	if err != nil {
 		return err
@@ -71,6 +82,8 @@ type ReconcileServiceCache struct {
 	// that reads objects from the cache and writes to the apiserver
 	client client.Client
 	scheme *runtime.Scheme
+	// recorder records the events of the ServiceCaches and their Services, for the users who cannot read the logs
+	recorder record.EventRecorder
 }
 
 // Reconcile reads that state of the cluster for a ServiceCache object and makes changes based on the state read
@@ -82,8 +95,15 @@ func (r *ReconcileServiceCache) Reconcile(request reconcile.Request) (reconcile.
 	logger := log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
 	logger.Info("Reconciling ServiceCache")
 
+	// the objects of the namespaces which are not opted in are left as they are
+	if selected, err := controller_utils.IsNamespaceSelected(request.Namespace); err != nil {
+		return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonRead, err)
+	} else if !selected {
+		return reconcile.Result{}, nil
+	}
+
 	// Fetch the ServiceCache instance
-	instance := &cachev1alpha1.ServiceCache{
+	instance := &cachev1beta1.ServiceCache{
 		ObjectMeta: metav1.ObjectMeta {
 			Name:      request.Name,
 			Namespace: request.Namespace,
@@ -92,21 +112,46 @@ func (r *ReconcileServiceCache) Reconcile(request reconcile.Request) (reconcile.
 	err1 := r.client.Get(context.TODO(), request.NamespacedName, instance)
 	if err1 != nil {
 		if errors.IsNotFound(err1) {
-			// remove the annotations on its related Service object.
-			logger.Info("ServiceCache object is not found, so remove annotations from the related Service", "Service.Name", request.Name)
-			r.removeAnnotationsFromService(instance.Namespace, instance.Name)
-	
+			// the Service has been cleaned up by the finalizer, unless the ServiceCache was deleted without it, e.g. when
+			// its finalizer is removed by hand
+			if err := r.cleanupLinkedService(request.Name, request.Namespace); err != nil {
+				logger.Error(err, "Failed to clean up the Service", "Service.Name", request.Name)
+				return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonRouting, err)
+			}
+
 			// Request object not found, could have been deleted after reconcile request.
 			// Return and don't requeue
 			return reconcile.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
-		return reconcile.Result{}, err1
+		return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonRead, err1)
 	}
 
-	if !validateServiceCache(instance) {
-		logger.Info("The configuration in ServiceCache object is correct, so remove it")
-		r.client.Delete(context.TODO(), instance)
+	if instance.DeletionTimestamp != nil {
+		// restore the Service before the ServiceCache is gone
+		if err := r.finalize(instance); err != nil {
+			logger.Error(err, "Failed to clean up the Service of the deleted ServiceCache")
+			return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonRouting, err)
+		}
+		return reconcile.Result{}, nil
+	}
+	if controller_utils.LinkToService(instance) {
+		if err := r.client.Update(context.TODO(), instance); err != nil {
+			logger.Error(err, "Failed to link the ServiceCache to its Service")
+			return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonSync, err)
+		}
+	}
+
+	if err := validateServiceCache(instance); err != nil {
+		// don't sync an invalid configuration to the Service, and tell the user why in the status
+		logger.Info("The configuration in ServiceCache object is not correct", "Reason", err.Error())
+		controller_utils.ValidationFailuresTotal.WithLabelValues(controllerName).Inc()
+		r.recorder.Eventf(instance, corev1.EventTypeWarning, controller_utils.EventInvalidConfiguration,
+			"The configuration is invalid and is not synced to the Service: %v", err)
+		if err := r.updateStatus(nil, instance, err, nil); err != nil {
+			logger.Error(err, "Failed to update the status of the ServiceCache")
+			return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonStatus, err)
+		}
 		return reconcile.Result{}, nil
 	}
 
@@ -115,25 +160,50 @@ func (r *ReconcileServiceCache) Reconcile(request reconcile.Request) (reconcile.
 		if errors.IsNotFound(err) {
 			logger.Info("No related Service found, so delete the ServiceCache")
 			// remove this servicecache object, since its corresponding service is not existent.
-			r.client.Delete(context.TODO(), instance)
+			if err := r.client.Delete(context.TODO(), instance); err == nil {
+				controller_utils.OrphansDeletedTotal.WithLabelValues(controllerName).Inc()
+			}
+			r.recorder.Event(instance, corev1.EventTypeNormal, controller_utils.EventServiceCacheDeletedOrphan,
+				"Deleted the ServiceCache since its Service doesn't exist")
 			return reconcile.Result{}, nil
 		}
-		return reconcile.Result{}, err
+		return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonRead, err)
 	}
 
-	hasDiff := controller_utils.DiffServiceAndServiceCache(svc, instance)
-	if !hasDiff {
-		logger.Info("Configuration between Service and its ServiceCache has no difference")
-		return reconcile.Result{}, nil
+	plan := controller_utils.PlanSync(controller_utils.ControllerOptions.SourceOfTruth, svc, instance)
+	controller_utils.RecordDiffs(controllerName, plan)
+	if len(plan.Conflicts) > 0 {
+		logger.Info("Configuration has been changed on both the Service and its ServiceCache, so don't sync it", "Fields", plan.Conflicts)
+		r.recorder.Eventf(instance, corev1.EventTypeWarning, controller_utils.EventSyncConflict,
+			"The fields %s have been changed on both the ServiceCache and its Service, they are not synced",
+			strings.Join(plan.Conflicts, ", "))
+	}
+	if len(plan.ToService) > 0 {
+		// read the configuration from service cache object, and update the annotations in service object
+		if err := r.syncServiceCacheToService(instance, svc, plan.ToService); err != nil {
+			logger.Error(err, "Failed to update the annotations of the Service")
+			r.recorder.Eventf(instance, corev1.EventTypeWarning, controller_utils.EventSyncFailed,
+				"Failed to update the annotations of the Service: %v", err)
+			return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonSync, err)
+		}
+		logger.Info("Configuration has been synced to Service from ServiceCache", "Fields", plan.ToService)
+		controller_utils.SyncsTotal.WithLabelValues(controllerName, controller_utils.DirectionToService).Inc()
+		r.recorder.Eventf(svc, corev1.EventTypeNormal, controller_utils.EventAnnotationsSynced,
+			"Updated the service cache annotations of %s from the ServiceCache", strings.Join(plan.ToService, ", "))
+	} else {
+		logger.Info("No configuration to sync from the ServiceCache to its Service")
+		// remember the fields in sync, to tell which side changes them next
+		if controller_utils.RecordLastSynced(svc, instance) {
+			if err := r.client.Update(context.TODO(), svc); err != nil {
+				logger.Error(err, "Failed to record the configuration in sync in the Service")
+				return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonSync, err)
+			}
+		}
 	}
 
-	// read the configuration from service cache object, and update the annotations in service object
-	r.syncServiceCacheToService(instance, svc)
-	logger.Info("Configuration has been synced to Service from ServiceCache")
-
-	// Set ServiceCache instance as the owner and controller
-	if err := controllerutil.SetControllerReference(instance, svc, r.scheme); err != nil {
-		return reconcile.Result{}, err
+	if err := r.updateStatus(svc, instance, nil, plan.Conflicts); err != nil {
+		logger.Error(err, "Failed to update the status of the ServiceCache")
+		return reconcile.Result{}, controller_utils.ReconcileFailed(controllerName, controller_utils.ErrorReasonStatus, err)
 	}
 
 	// Service has been labelled - don't requeue
@@ -141,26 +211,136 @@ func (r *ReconcileServiceCache) Reconcile(request reconcile.Request) (reconcile.
 	return reconcile.Result{}, nil
 }
 
-func (r *ReconcileServiceCache) syncServiceCacheToService(sc *cachev1alpha1.ServiceCache, svc *corev1.Service) error {
-	svc.Annotations[controller_utils.KeyOfCacheableByDefault] = strconv.FormatBool(sc.Spec.CacheableByDefault)
-	if sc.Spec.URLs != nil {
-		var b strings.Builder
-		b.WriteString("[")
-		b.WriteString(strings.Join(sc.Spec.URLs, ","))
-		b.WriteString("]")
-		svc.Annotations[controller_utils.KeyOfCacheableUrls] = b.String()
-	}
-	r.client.Update(context.TODO(), svc)
-  return nil
+// updateStatus records in the status of sc whether it's synced with svc.
+// invalid is the reason why the configuration of sc is rejected, or nil if it's valid.
+// conflicts are the fields changed on both svc and sc, which are not synced.
+func (r *ReconcileServiceCache) updateStatus(svc *corev1.Service, sc *cachev1beta1.ServiceCache, invalid error, conflicts []string) error {
+	status := sc.Status.DeepCopy()
+	status.ObservedGeneration = sc.Generation
+	controller_utils.SetInvalidCondition(status, "InvalidServiceCache", invalid)
+	if invalid == nil {
+		controller_utils.SetSyncedStatus(status, svc, sc, conflicts)
+	}
+	controller_utils.SetReadyCondition(status)
+
+	if reflect.DeepEqual(status, &sc.Status) {
+		return nil
+	}
+	sc.Status = *status
+	return r.client.Status().Update(context.TODO(), sc)
 }
 
-func (r *ReconcileServiceCache) removeAnnotationsFromService(svcName, svcNamespace string) error {
-	svc, err := r.findService(svcName, svcNamespace)
+// syncServiceCacheToService copies fields from sc to the annotations of svc, and updates svc
+func (r *ReconcileServiceCache) syncServiceCacheToService(sc *cachev1beta1.ServiceCache, svc *corev1.Service, fields []string) error {
+	if svc.Annotations == nil {
+		svc.Annotations = map[string]string{}
+	}
+	for _, f := range fields {
+		switch f {
+		case controller_utils.FieldCacheableByDefault:
+			svc.Annotations[controller_utils.KeyOfCacheableByDefault] = strconv.FormatBool(sc.Spec.CacheableByDefault)
+		case controller_utils.FieldURLs:
+			if sc.Spec.URLs != nil {
+				svc.Annotations[controller_utils.KeyOfCacheableUrls] = controller_utils.FormatURLs(sc.Spec.URLs)
+			} else {
+				delete(svc.Annotations, controller_utils.KeyOfCacheableUrls)
+			}
+		case controller_utils.FieldMode:
+			if sc.Spec.Mode != "" {
+				svc.Annotations[controller_utils.KeyOfMode] = string(sc.Spec.Mode)
+			} else {
+				delete(svc.Annotations, controller_utils.KeyOfMode)
+			}
+		case controller_utils.FieldRules:
+			if len(sc.Spec.Rules) > 0 {
+				rules, err := controller_utils.FormatRules(sc.Spec.Rules)
+				if err != nil {
+					return err
+				}
+				svc.Annotations[controller_utils.KeyOfRules] = rules
+			} else {
+				delete(svc.Annotations, controller_utils.KeyOfRules)
+			}
+		case controller_utils.FieldStaleWhileRevalidate:
+			setOrDeleteAnnotation(svc, controller_utils.KeyOfStaleWhileRevalidate, controller_utils.FormatDuration(sc.Spec.StaleWhileRevalidate))
+		case controller_utils.FieldStaleIfError:
+			setOrDeleteAnnotation(svc, controller_utils.KeyOfStaleIfError, controller_utils.FormatDuration(sc.Spec.StaleIfError))
+		}
+	}
+	// remember the fields in sync, to tell which side changes them next
+	controller_utils.RecordLastSynced(svc, sc)
+	return r.client.Update(context.TODO(), svc)
+}
+
+// finalize tears down the cache of the deleted ServiceCache sc: it restores its Service and deletes the cache proxy,
+// then releases the finalizer of sc
+func (r *ReconcileServiceCache) finalize(sc *cachev1beta1.ServiceCache) error {
+	if !controller_utils.HasFinalizer(sc, controller_utils.FinalizerCleanup) {
+		return nil
+	}
+	svc, err := r.findService(sc.Name, sc.Namespace)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
 	if err == nil {
-		delete(svc.Annotations, controller_utils.KeyOfCacheableByDefault)
-		delete(svc.Annotations, controller_utils.KeyOfCacheableUrls)
+		if err := r.cleanupService(svc); err != nil {
+			return err
+		}
+	}
+	// the cache proxy is owned by sc, but the garbage collector may delete it after the finalizer is released
+	objects := []runtime.Object{
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: controller_utils.ProxyDeploymentName(sc.Name), Namespace: sc.Namespace}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: controller_utils.OriginServiceName(sc.Name), Namespace: sc.Namespace}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: controller_utils.PurgeSecretName(sc), Namespace: sc.Namespace}},
+	}
+	for _, obj := range objects {
+		if err := r.client.Delete(context.TODO(), obj); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	controller_utils.RemoveFinalizer(sc, controller_utils.FinalizerCleanup)
+	log.Info("The Service has been cleaned up, release the ServiceCache", "ServiceCache.Namespace", sc.Namespace, "ServiceCache.Name", sc.Name)
+	return r.client.Update(context.TODO(), sc)
+}
+
+// setOrDeleteAnnotation sets the annotation key of svc to value, or deletes it if value is empty
+func setOrDeleteAnnotation(svc *corev1.Service, key, value string) {
+	if value != "" {
+		svc.Annotations[key] = value
+	} else {
+		delete(svc.Annotations, key)
+	}
+}
+
+// cleanupLinkedService cleans up the Service if it's still linked to its deleted ServiceCache by the FinalizerCleanup.
+// The Services without it may be annotated for a ServiceCache not created yet.
+func (r *ReconcileServiceCache) cleanupLinkedService(svcName, svcNamespace string) error {
+	svc, err := r.findService(svcName, svcNamespace)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !controller_utils.HasFinalizer(svc, controller_utils.FinalizerCleanup) {
+		return nil
 	}
-	return err
+	return r.cleanupService(svc)
+}
+
+// cleanupService restores svc as it was before it was cached: its original routing, without the service cache
+// annotations, nor finalizer
+func (r *ReconcileServiceCache) cleanupService(svc *corev1.Service) error {
+	cleaned, err := controller_utils.CleanupService(svc)
+	if err != nil || !cleaned {
+		return err
+	}
+	if err := r.client.Update(context.TODO(), svc); err != nil {
+		return err
+	}
+	r.recorder.Event(svc, corev1.EventTypeNormal, controller_utils.EventServiceCleanedUp,
+		"Removed the service cache annotations and restored the original selector since the ServiceCache has been deleted")
+	return nil
 }
 
 func (r *ReconcileServiceCache) findService(svcName, svcNamespace string) (*corev1.Service, error) {
@@ -174,7 +354,7 @@ func (r *ReconcileServiceCache) findService(svcName, svcNamespace string) (*core
 	return svc, err
 }
 
-func validateServiceCache(sc *cachev1alpha1.ServiceCache) bool {
-	//TODO: validate configurations in ServiceCache object
-  return true
+// validateServiceCache returns an error describing why the configuration in sc is rejected, or nil
+func validateServiceCache(sc *cachev1beta1.ServiceCache) error {
+	return controller_utils.ValidateServiceCacheSpec(&sc.Spec, field.NewPath("spec")).ToAggregate()
 }
\ No newline at end of file
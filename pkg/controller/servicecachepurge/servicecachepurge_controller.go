@@ -0,0 +1,283 @@
+package servicecachepurge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	cachev1beta1 "service-cache-operator/pkg/apis/cache/v1beta1"
+	controller_utils "service-cache-operator/pkg/controller/utils"
+	"service-cache-operator/pkg/httpcache"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+var log = logf.Log.WithName("controller_servicecachepurge")
+
+// purgeTimeout is how long a cache proxy has to answer a purge request
+const purgeTimeout = 10 * time.Second
+
+// Add creates a new ServiceCachePurge Controller and adds it to the Manager. The Manager will set fields on the
+// Controller and Start it when the Manager is Started.
+func Add(mgr manager.Manager) error {
+	return add(mgr, newReconciler(mgr))
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+	return &ReconcileServiceCachePurge{
+		client:     mgr.GetClient(),
+		scheme:     mgr.GetScheme(),
+		recorder:   mgr.GetRecorder("servicecachepurge-controller"),
+		httpClient: &http.Client{Timeout: purgeTimeout},
+	}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	// Create a new controller
+	c, err := controller.New("servicecachepurge-controller", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to primary resource ServiceCachePurge
+	err = c.Watch(&source.Kind{Type: &cachev1beta1.ServiceCachePurge{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// blank assignment to verify that ReconcileServiceCachePurge implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileServiceCachePurge{}
+
+// ReconcileServiceCachePurge reconciles a ServiceCachePurge object
+type ReconcileServiceCachePurge struct {
+	// This client, initialized using mgr.Client() above, is a split client
+	// that reads objects from the cache and writes to the apiserver
+	client client.Client
+	scheme *runtime.Scheme
+	// recorder records the events of the ServiceCachePurges, for the users who cannot read the logs
+	recorder record.EventRecorder
+	// httpClient sends the purge requests to the cache proxies
+	httpClient *http.Client
+}
+
+// Reconcile sends the purge described by a ServiceCachePurge to every cache proxy of its ServiceCache, once.
+// A purge which cannot be done by some cache proxies is retried for all of them, which is harmless.
+// Note:
+// The Controller will requeue the Request to be processed again if the returned error is non-nil or
+// Result.Requeue is true, otherwise upon completion it will remove the work from the queue.
+func (r *ReconcileServiceCachePurge) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	logger := log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
+	logger.Info("Reconciling ServiceCachePurge")
+
+	// the objects of the namespaces which are not opted in are left as they are
+	if selected, err := controller_utils.IsNamespaceSelected(request.Namespace); err != nil {
+		return reconcile.Result{}, err
+	} else if !selected {
+		return reconcile.Result{}, nil
+	}
+
+	// Fetch the ServiceCachePurge instance
+	instance := &cachev1beta1.ServiceCachePurge{}
+	err := r.client.Get(context.TODO(), request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Request object not found, could have been deleted after reconcile request.
+			// Return and don't requeue
+			return reconcile.Result{}, nil
+		}
+		// Error reading the object - requeue the request.
+		return reconcile.Result{}, err
+	}
+	if instance.Status.Phase == cachev1beta1.PurgeCompleted || instance.Status.Phase == cachev1beta1.PurgeFailed {
+		// a purge is only done once
+		return reconcile.Result{}, nil
+	}
+
+	if err := controller_utils.ValidateServiceCachePurgeSpec(&instance.Spec, field.NewPath("spec")).ToAggregate(); err != nil {
+		return reconcile.Result{}, r.fail(instance, fmt.Sprintf("The purge is invalid: %v", err))
+	}
+	sc := &cachev1beta1.ServiceCache{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.ServiceCacheName, Namespace: instance.Namespace}, sc)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, r.fail(instance, fmt.Sprintf("The ServiceCache %s doesn't exist", instance.Spec.ServiceCacheName))
+		}
+		return reconcile.Result{}, err
+	}
+	// the Service has the name of its ServiceCache
+	svc := &corev1.Service{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: sc.Name, Namespace: sc.Namespace}, svc)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, r.fail(instance, fmt.Sprintf("The Service %s doesn't exist", sc.Name))
+		}
+		return reconcile.Result{}, err
+	}
+
+	replicas, purged, err := r.purge(instance, sc, svc)
+	status := instance.Status.DeepCopy()
+	status.Replicas = replicas
+	status.Purged = purged
+	if err != nil {
+		logger.Error(err, "Failed to purge the cached responses")
+		r.recorder.Eventf(instance, corev1.EventTypeWarning, controller_utils.EventPurgeFailed,
+			"Failed to purge the cached responses, retrying: %v", err)
+		status.Phase = cachev1beta1.PurgePending
+		status.Message = err.Error()
+		if err := r.updateStatus(instance, status); err != nil {
+			logger.Error(err, "Failed to update the status of the ServiceCachePurge")
+		}
+		return reconcile.Result{}, err
+	}
+
+	logger.Info("Purged the cached responses", "Replicas", replicas, "Purged", purged)
+	r.recorder.Eventf(instance, corev1.EventTypeNormal, controller_utils.EventPurged,
+		"Purged %d cached responses from %d cache proxy replicas", purged, replicas)
+	now := metav1.Now()
+	status.Phase = cachev1beta1.PurgeCompleted
+	status.CompletionTime = &now
+	status.Message = ""
+	return reconcile.Result{}, r.updateStatus(instance, status)
+}
+
+// purge sends the purge to the cache proxies serving svc, and returns how many of them have done it and how many
+// responses they deleted
+func (r *ReconcileServiceCachePurge) purge(instance *cachev1beta1.ServiceCachePurge, sc *cachev1beta1.ServiceCache, svc *corev1.Service) (int32, int64, error) {
+	secret := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: controller_utils.PurgeSecretName(sc), Namespace: sc.Namespace}, secret)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read the purge token: %v", err)
+	}
+	token := string(secret.Data[controller_utils.PurgeTokenKey])
+
+	body, err := json.Marshal(httpcache.Purge{
+		All:          instance.Spec.All,
+		Keys:         instance.Spec.Keys,
+		PathPrefixes: instance.Spec.PathPrefixes,
+		PathRegexes:  instance.Spec.PathRegexes,
+		Tags:         instance.Spec.Tags,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// the Service selects the pods serving its traffic: the cache proxy pods in proxy mode, the pods with the cache
+	// proxy sidecar in sidecar mode
+	if len(svc.Spec.Selector) == 0 {
+		return 0, 0, nil
+	}
+	pods := &corev1.PodList{}
+	opts := &client.ListOptions{Namespace: svc.Namespace, LabelSelector: labels.SelectorFromSet(svc.Spec.Selector)}
+	if err := r.client.List(context.TODO(), opts, pods); err != nil {
+		return 0, 0, err
+	}
+
+	var replicas int32
+	var purged int64
+	var failures []string
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" {
+			continue
+		}
+		port := adminPort(pod)
+		if port == 0 {
+			// e.g. a pod with a sidecar injected by a previous version of the operator
+			failures = append(failures, fmt.Sprintf("pod %s has no cache proxy admin port, restart it", pod.Name))
+			continue
+		}
+		result, err := r.send(fmt.Sprintf("http://%s:%d%s", pod.Status.PodIP, port, controller_utils.ProxyPurgePath), token, body)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("pod %s: %v", pod.Name, err))
+			continue
+		}
+		replicas++
+		purged += int64(result.Purged)
+	}
+	if len(failures) > 0 {
+		return replicas, purged, fmt.Errorf("%s", strings.Join(failures, "; "))
+	}
+	return replicas, purged, nil
+}
+
+// send posts a purge to the purge endpoint at url
+func (r *ReconcileServiceCachePurge) send(url, token string, body []byte) (*httpcache.PurgeResult, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the cache proxy answered %s", res.Status)
+	}
+	result := &httpcache.PurgeResult{}
+	if err := json.NewDecoder(res.Body).Decode(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// adminPort returns the admin port of the cache proxy container of pod, or 0
+func adminPort(pod *corev1.Pod) int32 {
+	for _, c := range pod.Spec.Containers {
+		if c.Name != controller_utils.ProxyContainerName {
+			continue
+		}
+		for _, p := range c.Ports {
+			if p.Name == controller_utils.ProxyAdminPortName {
+				return p.ContainerPort
+			}
+		}
+	}
+	return 0
+}
+
+// fail records that the purge cannot be done, it's not retried
+func (r *ReconcileServiceCachePurge) fail(instance *cachev1beta1.ServiceCachePurge, message string) error {
+	log.Info("The purge cannot be done", "ServiceCachePurge.Namespace", instance.Namespace,
+		"ServiceCachePurge.Name", instance.Name, "Reason", message)
+	r.recorder.Event(instance, corev1.EventTypeWarning, controller_utils.EventPurgeFailed, message)
+	status := instance.Status.DeepCopy()
+	status.Phase = cachev1beta1.PurgeFailed
+	status.Message = message
+	return r.updateStatus(instance, status)
+}
+
+// updateStatus replaces the status of instance by status, if it changed
+func (r *ReconcileServiceCachePurge) updateStatus(instance *cachev1beta1.ServiceCachePurge, status *cachev1beta1.ServiceCachePurgeStatus) error {
+	if reflect.DeepEqual(status, &instance.Status) {
+		return nil
+	}
+	instance.Status = *status
+	return r.client.Status().Update(context.TODO(), instance)
+}
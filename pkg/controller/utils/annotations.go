@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	cachev1beta1 "service-cache-operator/pkg/apis/cache/v1beta1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// KeyOfRules is the key for mapping the rules configuration, a JSON or YAML encoded list of CacheRule
+const KeyOfRules = "service-cache.github.io/rules"
+
+// KeyOfStaleWhileRevalidate is the key for mapping the stale-while-revalidate duration, e.g. "30s"
+const KeyOfStaleWhileRevalidate = "service-cache.github.io/stale-while-revalidate"
+
+// KeyOfStaleIfError is the key for mapping the stale-if-error duration, e.g. "10m"
+const KeyOfStaleIfError = "service-cache.github.io/stale-if-error"
+
+// ParseURLs returns the URL list of the KeyOfCacheableUrls annotation.
+// The value is either a JSON array, or the legacy bracketed comma-joined form, e.g. "[/a,/b]".
+func ParseURLs(value string) []string {
+	value = strings.TrimSpace(value)
+	var urls []string
+	if err := json.Unmarshal([]byte(value), &urls); err == nil {
+		return urls
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	return strings.Split(value, ",")
+}
+
+// FormatURLs returns the value of the KeyOfCacheableUrls annotation for urls, as a JSON array
+func FormatURLs(urls []string) string {
+	if urls == nil {
+		urls = []string{}
+	}
+	value, _ := json.Marshal(urls)
+	return string(value)
+}
+
+// ParseRules returns the rules of the KeyOfRules annotation, which is JSON or YAML encoded
+func ParseRules(value string) ([]cachev1beta1.CacheRule, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var rules []cachev1beta1.CacheRule
+	if err := yaml.Unmarshal([]byte(value), &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// FormatRules returns the value of the KeyOfRules annotation for rules, as JSON
+func FormatRules(rules []cachev1beta1.CacheRule) (string, error) {
+	value, err := json.Marshal(rules)
+	return string(value), err
+}
+
+// ParseDuration returns the duration of a duration annotation such as KeyOfStaleIfError, or nil if it's empty
+func ParseDuration(value string) (*metav1.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return nil, err
+	}
+	return &metav1.Duration{Duration: d}, nil
+}
+
+// FormatDuration returns the value of a duration annotation for d, or "" if it's nil
+func FormatDuration(d *metav1.Duration) string {
+	if d == nil {
+		return ""
+	}
+	return d.Duration.String()
+}
@@ -0,0 +1,35 @@
+package utils
+
+// Reasons of the events recorded on Services, ServiceCaches and ServiceCachePurges
+const (
+	// EventServiceCacheCreated is recorded when a ServiceCache is created for an annotated Service
+	EventServiceCacheCreated = "ServiceCacheCreated"
+	// EventServiceCacheSynced is recorded when a ServiceCache is updated from the annotations of its Service
+	EventServiceCacheSynced = "ServiceCacheSynced"
+	// EventAnnotationsSynced is recorded when the annotations of a Service are updated from its ServiceCache
+	EventAnnotationsSynced = "AnnotationsSynced"
+	// EventServiceCacheDeleted is recorded when the ServiceCache of a Service which is deleted or not annotated anymore is deleted
+	EventServiceCacheDeleted = "ServiceCacheDeleted"
+	// EventServiceCacheDeletedOrphan is recorded when a ServiceCache whose Service doesn't exist is deleted
+	EventServiceCacheDeletedOrphan = "ServiceCacheDeletedOrphan"
+	// EventInvalidConfiguration is recorded when the configuration of a Service or a ServiceCache is rejected
+	EventInvalidConfiguration = "InvalidConfiguration"
+	// EventProxyRouted is recorded when the traffic of a Service is sent to the cache proxy
+	EventProxyRouted = "ProxyRouted"
+	// EventRoutingRestored is recorded when the traffic of a Service is sent back to its original pods
+	EventRoutingRestored = "RoutingRestored"
+	// EventServiceCleanedUp is recorded when a Service is restored as it was before it was cached, as its ServiceCache is deleted
+	EventServiceCleanedUp = "ServiceCleanedUp"
+	// EventProxyFailed is recorded when the traffic of a Service cannot be routed through the cache proxy
+	EventProxyFailed = "ProxyFailed"
+	// EventSyncFailed is recorded when a Service and its ServiceCache cannot be synced
+	EventSyncFailed = "SyncFailed"
+	// EventSyncConflict is recorded when a field is changed on both a Service and its ServiceCache since they were last synced
+	EventSyncConflict = "SyncConflict"
+	// EventCacheInvalidated is recorded when the cache generation of a ServiceCache is incremented after a rollout
+	EventCacheInvalidated = "CacheInvalidated"
+	// EventPurged is recorded when the cache proxies of a Service have deleted the responses described by a ServiceCachePurge
+	EventPurged = "Purged"
+	// EventPurgeFailed is recorded when a cache proxy of a Service cannot delete the responses described by a ServiceCachePurge
+	EventPurgeFailed = "PurgeFailed"
+)
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FinalizerCleanup is the finalizer of the ServiceCaches and of the Services routed through the cache proxy. It's
+// released once the Service is restored: the service cache annotations removed, the original routing put back and
+// the cache proxy deleted.
+const FinalizerCleanup = "service-cache.github.io/cleanup"
+
+// HasFinalizer returns true if obj has the finalizer
+func HasFinalizer(obj metav1.Object, finalizer string) bool {
+	for _, f := range obj.GetFinalizers() {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// AddFinalizer adds the finalizer to obj.
+// return true if obj has been changed
+func AddFinalizer(obj metav1.Object, finalizer string) bool {
+	if HasFinalizer(obj, finalizer) {
+		return false
+	}
+	obj.SetFinalizers(append(obj.GetFinalizers(), finalizer))
+	return true
+}
+
+// RemoveFinalizer removes the finalizer from obj.
+// return true if obj has been changed
+func RemoveFinalizer(obj metav1.Object, finalizer string) bool {
+	var finalizers []string
+	for _, f := range obj.GetFinalizers() {
+		if f != finalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	if len(finalizers) == len(obj.GetFinalizers()) {
+		return false
+	}
+	obj.SetFinalizers(finalizers)
+	return true
+}
+
+// CleanupService restores svc as it was before it was cached: it puts back its original routing, removes the
+// service cache annotations and the annotations of the operator, and releases its finalizer and its ServiceCache.
+// return true if svc has been changed
+func CleanupService(svc *corev1.Service) (bool, error) {
+	changed, err := RestoreServiceRouting(svc)
+	if err != nil {
+		return false, err
+	}
+	for k := range svc.Annotations {
+		if strings.HasPrefix(k, KeyPrefix) || k == KeyOfLastSynced {
+			delete(svc.Annotations, k)
+			changed = true
+		}
+	}
+	if RemoveFinalizer(svc, FinalizerCleanup) {
+		changed = true
+	}
+	// a Service still owned by its ServiceCache would be deleted with it by the garbage collector
+	if RemoveOwnerReferences(svc, serviceCacheGroupKind) {
+		changed = true
+	}
+	return changed, nil
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Directions of the differences between a Service and its ServiceCache, the values of the direction label
+const (
+	DirectionToService      = "to_service"
+	DirectionToServiceCache = "to_servicecache"
+	DirectionConflict       = "conflict"
+)
+
+// Reasons of the failed reconciles, the values of the reason label
+const (
+	// ErrorReasonRead is a failure to read a Service or a ServiceCache
+	ErrorReasonRead = "read"
+	// ErrorReasonCreate is a failure to create the ServiceCache of a Service
+	ErrorReasonCreate = "create"
+	// ErrorReasonSync is a failure to update a Service or a ServiceCache with the configuration of the other
+	ErrorReasonSync = "sync"
+	// ErrorReasonProxy is a failure to route a Service through the cache proxy
+	ErrorReasonProxy = "proxy"
+	// ErrorReasonRouting is a failure to restore the original routing of a Service
+	ErrorReasonRouting = "routing"
+	// ErrorReasonStatus is a failure to update the status of a ServiceCache
+	ErrorReasonStatus = "status"
+)
+
+// Metrics of the reconcilers, served on the metrics port of the operator with the metrics of controller-runtime
+var (
+	// SyncsTotal counts the Services and ServiceCaches updated from the configuration of the other
+	SyncsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "service_cache_operator_syncs_total",
+		Help: "Services and ServiceCaches updated from the configuration of the other, by controller and direction.",
+	}, []string{"controller", "direction"})
+	// DiffsDetectedTotal counts the reconciles which found a Service and its ServiceCache different
+	DiffsDetectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "service_cache_operator_diffs_detected_total",
+		Help: "Reconciles which found a Service and its ServiceCache different, by controller and direction.",
+	}, []string{"controller", "direction"})
+	// ValidationFailuresTotal counts the reconciles which rejected the configuration of a Service or a ServiceCache
+	ValidationFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "service_cache_operator_validation_failures_total",
+		Help: "Reconciles which rejected an invalid configuration, by controller.",
+	}, []string{"controller"})
+	// OrphansDeletedTotal counts the ServiceCaches deleted because their Service doesn't exist
+	OrphansDeletedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "service_cache_operator_orphans_deleted_total",
+		Help: "ServiceCaches deleted because their Service doesn't exist, by controller.",
+	}, []string{"controller"})
+	// ReconcileErrorsTotal counts the failed reconciles, which are retried
+	ReconcileErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "service_cache_operator_reconcile_errors_total",
+		Help: "Failed reconciles, by controller and reason.",
+	}, []string{"controller", "reason"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(SyncsTotal, DiffsDetectedTotal, ValidationFailuresTotal, OrphansDeletedTotal, ReconcileErrorsTotal)
+}
+
+// RecordDiffs counts the differences planned by plan between a Service and its ServiceCache
+func RecordDiffs(controller string, plan SyncPlan) {
+	if len(plan.ToService) > 0 {
+		DiffsDetectedTotal.WithLabelValues(controller, DirectionToService).Inc()
+	}
+	if len(plan.ToServiceCache) > 0 {
+		DiffsDetectedTotal.WithLabelValues(controller, DirectionToServiceCache).Inc()
+	}
+	if len(plan.Conflicts) > 0 {
+		DiffsDetectedTotal.WithLabelValues(controller, DirectionConflict).Inc()
+	}
+}
+
+// ReconcileFailed counts a reconcile of controller failed for reason, and returns err
+func ReconcileFailed(controller, reason string, err error) error {
+	ReconcileErrorsTotal.WithLabelValues(controller, reason).Inc()
+	return err
+}
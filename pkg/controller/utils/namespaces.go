@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ParseWatchNamespaces returns the namespaces listed in value, the WATCH_NAMESPACE of the operator, separated by
+// commas. It returns nil when value is empty, to watch all the namespaces.
+func ParseWatchNamespaces(value string) []string {
+	var namespaces []string
+	for _, ns := range strings.Split(value, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
+
+// ParseNamespaceSelector parses the label selector of the namespaces opted in, e.g. "service-cache=enabled".
+// It returns nil when value is empty, to select all the namespaces.
+func ParseNamespaceSelector(value string) (*metav1.LabelSelector, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	selector, err := metav1.ParseToLabelSelector(value)
+	if err != nil {
+		return nil, err
+	}
+	// reject the selectors which cannot be converted, e.g. with unsupported operators
+	if _, err := metav1.LabelSelectorAsSelector(selector); err != nil {
+		return nil, err
+	}
+	return selector, nil
+}
+
+// IsNamespaceSelected returns true if the objects of namespace are reconciled, i.e. if it matches the
+// NamespaceSelector of the ControllerOptions
+func IsNamespaceSelected(namespace string) (bool, error) {
+	if ControllerOptions.NamespaceSelector == nil {
+		return true, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(ControllerOptions.NamespaceSelector)
+	if err != nil {
+		return false, err
+	}
+	ns := &corev1.Namespace{}
+	err = ControllerOptions.NamespaceReader.Get(context.TODO(), types.NamespacedName{Name: namespace}, ns)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return selector.Matches(labels.Set(ns.Labels)), nil
+}
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Options are the settings of the operator shared by the controllers
+type Options struct {
+	// SourceOfTruth is which side holds the configuration when a Service and its ServiceCache are different
+	SourceOfTruth SourceOfTruth
+	// NamespaceSelector selects the namespaces whose objects are reconciled, all the watched namespaces if nil.
+	// It's also the namespace selector of the admission webhooks.
+	NamespaceSelector *metav1.LabelSelector
+	// NamespaceReader reads the labels of the namespaces, it must be set with NamespaceSelector
+	NamespaceReader client.Reader
+	// SidecarInjection is true when the operator serves the webhook injecting the cache proxy sidecars, which the
+	// sidecar mode requires
+	SidecarInjection bool
+}
+
+// ControllerOptions are set from the command line of the operator before the controllers are added to the manager
+var ControllerOptions = Options{
+	SourceOfTruth: SourceOfTruthBidirectional,
+}
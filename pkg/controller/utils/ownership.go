@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"context"
+
+	cachev1beta1 "service-cache-operator/pkg/apis/cache/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// LabelOfService is the label linking a ServiceCache, and the objects created by the operator for it, to the Service
+// they serve. The user's Services and their ServiceCaches never own each other: a ServiceCache has the name of its
+// Service, and the FinalizerCleanup of both ties their lifecycles. Only the objects created by the operator, e.g. the
+// cache proxy Deployment, are owned by a ServiceCache.
+const LabelOfService = "service-cache.github.io/service"
+
+// serviceCacheGroupKind and serviceGroupKind are the kinds of the owner references to remove by MigrateOwnerReferences
+var (
+	serviceCacheGroupKind = schema.GroupKind{Group: cachev1beta1.SchemeGroupVersion.Group, Kind: "ServiceCache"}
+	serviceGroupKind      = schema.GroupKind{Group: corev1.GroupName, Kind: "Service"}
+)
+
+// LinkToService labels sc with the name of its Service, and adds the FinalizerCleanup restoring the Service when sc is
+// deleted.
+// return true if sc has been changed
+func LinkToService(sc *cachev1beta1.ServiceCache) bool {
+	changed := AddFinalizer(sc, FinalizerCleanup)
+	if sc.Labels[LabelOfService] != sc.Name {
+		if sc.Labels == nil {
+			sc.Labels = map[string]string{}
+		}
+		sc.Labels[LabelOfService] = sc.Name
+		changed = true
+	}
+	return changed
+}
+
+// RemoveOwnerReferences removes the owner references of obj to the objects of kind.
+// return true if obj has been changed
+func RemoveOwnerReferences(obj metav1.Object, kind schema.GroupKind) bool {
+	var refs []metav1.OwnerReference
+	for _, ref := range obj.GetOwnerReferences() {
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err == nil && gv.WithKind(ref.Kind).GroupKind() == kind {
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	if len(refs) == len(obj.GetOwnerReferences()) {
+		return false
+	}
+	obj.SetOwnerReferences(refs)
+	return true
+}
+
+// MigrateOwnerReferences removes the owner references set by the previous versions of the operator between the
+// Services and their ServiceCaches, in namespaces or in all the namespaces if empty. The ServiceCaches were the
+// controllers of their Services, so the garbage collector deleted a Service with its ServiceCache.
+// It returns the number of objects updated.
+func MigrateOwnerReferences(c client.Client, namespaces []string) (int, error) {
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	migrated := 0
+	for _, ns := range namespaces {
+		svcs := &corev1.ServiceList{}
+		if err := c.List(context.TODO(), &client.ListOptions{Namespace: ns}, svcs); err != nil {
+			return migrated, err
+		}
+		for i := range svcs.Items {
+			svc := &svcs.Items[i]
+			if !RemoveOwnerReferences(svc, serviceCacheGroupKind) {
+				continue
+			}
+			if err := c.Update(context.TODO(), svc); err != nil {
+				return migrated, err
+			}
+			migrated++
+		}
+
+		scs := &cachev1beta1.ServiceCacheList{}
+		if err := c.List(context.TODO(), &client.ListOptions{Namespace: ns}, scs); err != nil {
+			return migrated, err
+		}
+		for i := range scs.Items {
+			sc := &scs.Items[i]
+			if !RemoveOwnerReferences(sc, serviceGroupKind) {
+				continue
+			}
+			if err := c.Update(context.TODO(), sc); err != nil {
+				return migrated, err
+			}
+			migrated++
+		}
+	}
+	return migrated, nil
+}
@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"fmt"
+
+	cachev1beta1 "service-cache-operator/pkg/apis/cache/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ProxyImageEnvVar is the environment variable holding the image of the cache proxy
+const ProxyImageEnvVar = "PROXY_IMAGE"
+
+// ProxyContainerName is the name of the cache proxy container, in the proxy Deployment or as a sidecar
+const ProxyContainerName = "service-cache-proxy"
+
+// ProxyServiceAccountName is the ServiceAccount allowing the cache proxy to read its ServiceCache. The operator creates
+// it in the namespaces of the ServiceCaches.
+const ProxyServiceAccountName = "service-cache-proxy"
+
+// ProxyClusterRoleName is the ClusterRole reading the ServiceCaches, bound to ProxyServiceAccountName in the namespace
+// of each ServiceCache, see deploy/cluster_wide/proxy_cluster_role.yaml
+const ProxyClusterRoleName = "service-cache-proxy"
+
+// ProxyAppName is the value of the app.kubernetes.io/name label of the cache proxy pods
+const ProxyAppName = "service-cache-proxy"
+
+// SidecarPort is the port the cache proxy sidecar listens on
+const SidecarPort = 15080
+
+// SidecarPortName is the name of the port of the cache proxy sidecar. Services in sidecar mode target it.
+const SidecarPortName = "service-cache"
+
+// ProxyAdminPort is the port of the admin endpoints of the cache proxy Deployment: /purge and /metrics
+const ProxyAdminPort = 9080
+
+// SidecarAdminPort is the port of the admin endpoints of the cache proxy sidecar
+const SidecarAdminPort = 15081
+
+// ProxyAdminPortName is the name of the port of the admin endpoints of the cache proxy, in the Deployment or as a sidecar
+const ProxyAdminPortName = "cache-admin"
+
+// ProxyPurgePath is the path of the purge endpoint of the cache proxy, on its admin port
+const ProxyPurgePath = "/purge"
+
+// PurgeTokenEnvVar is the environment variable holding the token authenticating the requests to the purge endpoint
+const PurgeTokenEnvVar = "PURGE_TOKEN"
+
+// PurgeTokenKey is the key of the purge token in the Secret named by PurgeSecretName
+const PurgeTokenKey = "token"
+
+// ProxyCacheDir is where the cache proxy stores the cached responses with the Disk storage
+const ProxyCacheDir = "/var/cache/service-cache"
+
+// ProxyCacheVolumeName is the name of the emptyDir volume mounted on ProxyCacheDir
+const ProxyCacheVolumeName = "service-cache-storage"
+
+// RedisPasswordEnvVar is the environment variable holding the password of the Redis storage of the cache proxy
+const RedisPasswordEnvVar = "REDIS_PASSWORD"
+
+// ProxyDeploymentName returns the name of the cache proxy Deployment of the Service named svcName, in proxy mode
+func ProxyDeploymentName(svcName string) string {
+	return svcName + "-cache"
+}
+
+// OriginServiceName returns the name of the Service exposing the original pods of the Service named svcName, in proxy mode
+func OriginServiceName(svcName string) string {
+	return svcName + "-origin"
+}
+
+// ProxyRoleBindingName returns the name of the RoleBinding letting the cache proxies of sc read it
+func ProxyRoleBindingName(sc *cachev1beta1.ServiceCache) string {
+	return sc.Name + "-cache-proxy"
+}
+
+// PurgeSecretName returns the name of the Secret holding the token of the purge endpoints of the cache proxies of sc
+func PurgeSecretName(sc *cachev1beta1.ServiceCache) string {
+	return sc.Name + "-cache-purge"
+}
+
+// ProxyArgs returns the arguments of the cache proxy listening on port, with its admin endpoints on adminPort,
+// forwarding to upstream and configured by the ServiceCache of svc
+func ProxyArgs(port, adminPort int32, upstream string, svc *corev1.Service) []string {
+	return []string{
+		fmt.Sprintf("--listen=:%d", port),
+		fmt.Sprintf("--admin-listen=:%d", adminPort),
+		"--upstream=" + upstream,
+		"--servicecache-name=" + svc.Name,
+		"--servicecache-namespace=" + svc.Namespace,
+		"--cache-dir=" + ProxyCacheDir,
+	}
+}
+
+// ProxyEnv returns the environment of the cache proxy configured by sc, in addition to env
+func ProxyEnv(sc *cachev1beta1.ServiceCache, env ...corev1.EnvVar) []corev1.EnvVar {
+	// the Secret is optional so that the proxy starts before the operator creates it, with the purge endpoint disabled
+	optional := true
+	env = append(env, corev1.EnvVar{
+		Name: PurgeTokenEnvVar,
+		ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: PurgeSecretName(sc)},
+			Key:                  PurgeTokenKey,
+			Optional:             &optional,
+		}},
+	})
+	if storage := sc.Spec.Storage; storage != nil && storage.Redis != nil && storage.Redis.PasswordSecretRef != nil {
+		env = append(env, corev1.EnvVar{
+			Name:      RedisPasswordEnvVar,
+			ValueFrom: &corev1.EnvVarSource{SecretKeyRef: storage.Redis.PasswordSecretRef},
+		})
+	}
+	return env
+}
+
+// ProxyCacheVolume returns the volume the cache proxy stores the cached responses in with the Disk storage.
+// It's always mounted, so that the storage can change without restarting the pods.
+func ProxyCacheVolume() corev1.Volume {
+	return corev1.Volume{
+		Name:         ProxyCacheVolumeName,
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	}
+}
+
+// ProxyCacheVolumeMount returns the mount of ProxyCacheVolume in the cache proxy container
+func ProxyCacheVolumeMount() corev1.VolumeMount {
+	return corev1.VolumeMount{Name: ProxyCacheVolumeName, MountPath: ProxyCacheDir}
+}
+
+// IsPodReady returns true if pod has the Ready condition
+func IsPodReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// HasSidecar returns true if the cache proxy sidecar has been injected into pod: a container exposes SidecarPortName
+func HasSidecar(pod *corev1.Pod) bool {
+	for _, c := range pod.Spec.Containers {
+		for _, port := range c.Ports {
+			if port.Name == SidecarPortName {
+				return true
+			}
+		}
+	}
+	return false
+}
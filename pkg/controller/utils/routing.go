@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// KeyOfOriginalRouting is the key to save the routing of a Service before its traffic is sent to the cache proxy.
+// It is not under KeyPrefix, so it doesn't make the Service look like it's annotated by the user.
+const KeyOfOriginalRouting = "operator.service-cache.github.io/original-routing"
+
+// OriginalRouting is the routing of a Service before its traffic is sent to the cache proxy
+type OriginalRouting struct {
+	Selector   map[string]string  `json:"selector"`
+	TargetPort intstr.IntOrString `json:"targetPort"`
+}
+
+// GetOriginalRouting returns the routing saved in the annotations of svc, or nil if svc is not routed to the cache proxy
+func GetOriginalRouting(svc *corev1.Service) (*OriginalRouting, error) {
+	value, ok := svc.Annotations[KeyOfOriginalRouting]
+	if !ok {
+		return nil, nil
+	}
+	routing := &OriginalRouting{}
+	if err := json.Unmarshal([]byte(value), routing); err != nil {
+		return nil, err
+	}
+	return routing, nil
+}
+
+// SetOriginalRouting saves routing in the annotations of svc
+func SetOriginalRouting(svc *corev1.Service, routing *OriginalRouting) error {
+	value, err := json.Marshal(routing)
+	if err != nil {
+		return err
+	}
+	if svc.Annotations == nil {
+		svc.Annotations = map[string]string{}
+	}
+	svc.Annotations[KeyOfOriginalRouting] = string(value)
+	return nil
+}
+
+// RestoreServiceRouting puts back the selector and target port svc had before its traffic was sent to the cache proxy.
+// return true if svc has been changed
+func RestoreServiceRouting(svc *corev1.Service) (bool, error) {
+	routing, err := GetOriginalRouting(svc)
+	if err != nil || routing == nil {
+		return false, err
+	}
+	svc.Spec.Selector = routing.Selector
+	if len(svc.Spec.Ports) > 0 {
+		svc.Spec.Ports[0].TargetPort = routing.TargetPort
+	}
+	delete(svc.Annotations, KeyOfOriginalRouting)
+	return true, nil
+}
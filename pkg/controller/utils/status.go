@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	cachev1beta1 "service-cache-operator/pkg/apis/cache/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetCondition returns the condition of type t in status, or nil
+func GetCondition(status *cachev1beta1.ServiceCacheStatus, t cachev1beta1.ServiceCacheConditionType) *cachev1beta1.ServiceCacheCondition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == t {
+			return &status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// IsConditionTrue returns true if the condition of type t in status is true
+func IsConditionTrue(status *cachev1beta1.ServiceCacheStatus, t cachev1beta1.ServiceCacheConditionType) bool {
+	condition := GetCondition(status, t)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
+// SetCondition sets the condition of type t in status. The transition time only changes with the status.
+func SetCondition(status *cachev1beta1.ServiceCacheStatus, t cachev1beta1.ServiceCacheConditionType,
+	conditionStatus corev1.ConditionStatus, reason, message string) {
+	condition := GetCondition(status, t)
+	if condition == nil {
+		status.Conditions = append(status.Conditions, cachev1beta1.ServiceCacheCondition{Type: t})
+		condition = &status.Conditions[len(status.Conditions)-1]
+	}
+	if condition.Status != conditionStatus {
+		condition.Status = conditionStatus
+		condition.LastTransitionTime = metav1.Now()
+	}
+	condition.Reason = reason
+	condition.Message = message
+}
+
+// SetInvalidCondition sets the Invalid condition in status to true with reason if err is not nil, to false otherwise
+func SetInvalidCondition(status *cachev1beta1.ServiceCacheStatus, reason string, err error) {
+	if err != nil {
+		SetCondition(status, cachev1beta1.ConditionInvalid, corev1.ConditionTrue, reason, err.Error())
+		return
+	}
+	SetCondition(status, cachev1beta1.ConditionInvalid, corev1.ConditionFalse, "Valid", "")
+}
+
+// SetSyncedStatus records in the status of sc whether sc and the annotations of svc have the same configuration.
+// conflicts are the fields changed on both sides, which are not synced.
+func SetSyncedStatus(status *cachev1beta1.ServiceCacheStatus, svc *corev1.Service, sc *cachev1beta1.ServiceCache, conflicts []string) {
+	if len(conflicts) > 0 {
+		SetCondition(status, cachev1beta1.ConditionSynced, corev1.ConditionFalse, "Conflict",
+			fmt.Sprintf("The fields %s have been changed on both the ServiceCache and the annotations of its Service, "+
+				"change one side back to resolve the conflict", strings.Join(conflicts, ", ")))
+		return
+	}
+	if DiffServiceAndServiceCache(svc, sc) {
+		SetCondition(status, cachev1beta1.ConditionSynced, corev1.ConditionFalse, "OutOfSync",
+			"The ServiceCache and the annotations of its Service have a different configuration")
+		return
+	}
+	if !IsConditionTrue(status, cachev1beta1.ConditionSynced) || status.ServiceResourceVersion != svc.ResourceVersion {
+		now := metav1.Now()
+		status.LastSyncTime = &now
+	}
+	status.ServiceResourceVersion = svc.ResourceVersion
+	SetCondition(status, cachev1beta1.ConditionSynced, corev1.ConditionTrue, "InSync",
+		"The ServiceCache and the annotations of its Service have the same configuration")
+}
+
+// SetReadyCondition computes the Ready condition from the other conditions of status
+func SetReadyCondition(status *cachev1beta1.ServiceCacheStatus) {
+	switch {
+	case IsConditionTrue(status, cachev1beta1.ConditionInvalid):
+		SetCondition(status, cachev1beta1.ConditionReady, corev1.ConditionFalse, "InvalidConfiguration",
+			"The configuration is invalid")
+	case !IsConditionTrue(status, cachev1beta1.ConditionSynced):
+		SetCondition(status, cachev1beta1.ConditionReady, corev1.ConditionFalse, "NotSynced",
+			"The ServiceCache is not synced with its Service")
+	case !IsConditionTrue(status, cachev1beta1.ConditionProxyAvailable):
+		SetCondition(status, cachev1beta1.ConditionReady, corev1.ConditionFalse, "ProxyUnavailable",
+			"The traffic of the Service doesn't go through an available cache proxy")
+	default:
+		SetCondition(status, cachev1beta1.ConditionReady, corev1.ConditionTrue, "CacheActive",
+			"The responses of the Service are cached")
+	}
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"context"
+
+	cachev1beta1 "service-cache-operator/pkg/apis/cache/v1beta1"
+
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// storedResources are the CustomResourceDefinitions of the operator, with the lists of their objects
+var storedResources = []struct {
+	crd     string
+	newList func() runtime.Object
+}{
+	{"servicecaches.cache.service-cache.github.com", func() runtime.Object { return &cachev1beta1.ServiceCacheList{} }},
+	{"servicecachepurges.cache.service-cache.github.com", func() runtime.Object { return &cachev1beta1.ServiceCachePurgeList{} }},
+}
+
+// MigrateStorageVersion rewrites the ServiceCaches and ServiceCachePurges in the storage version, v1beta1, in
+// namespaces or in all the namespaces if empty: the API server stores an object in the storage version when it's
+// updated, even if unchanged. Once all the namespaces are rewritten, the storage version is set as the only stored
+// version of the CustomResourceDefinitions, and the objects are not rewritten again on the next starts. The
+// CustomResourceDefinitions are updated as unstructured, so that the fields unknown to the apiextensions types of the
+// client are kept. It returns the number of objects rewritten.
+func MigrateStorageVersion(c client.Client, namespaces []string) (int, error) {
+	allNamespaces := len(namespaces) == 0
+	if allNamespaces {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	migrated := 0
+	for _, resource := range storedResources {
+		crd := &unstructured.Unstructured{}
+		crd.SetGroupVersionKind(apiextensionsv1beta1.SchemeGroupVersion.WithKind("CustomResourceDefinition"))
+		if err := c.Get(context.TODO(), types.NamespacedName{Name: resource.crd}, crd); err != nil {
+			return migrated, err
+		}
+		storedVersions, _, err := unstructured.NestedStringSlice(crd.Object, "status", "storedVersions")
+		if err != nil {
+			return migrated, err
+		}
+		if len(storedVersions) == 1 && storedVersions[0] == cachev1beta1.SchemeGroupVersion.Version {
+			continue
+		}
+
+		for _, ns := range namespaces {
+			list := resource.newList()
+			if err := c.List(context.TODO(), &client.ListOptions{Namespace: ns}, list); err != nil {
+				return migrated, err
+			}
+			items, err := meta.ExtractList(list)
+			if err != nil {
+				return migrated, err
+			}
+			for _, item := range items {
+				if err := c.Update(context.TODO(), item); err != nil {
+					return migrated, err
+				}
+				migrated++
+			}
+		}
+
+		// the objects of the namespaces which are not watched may still be stored in a previous version
+		if allNamespaces {
+			err := unstructured.SetNestedStringSlice(crd.Object, []string{cachev1beta1.SchemeGroupVersion.Version},
+				"status", "storedVersions")
+			if err != nil {
+				return migrated, err
+			}
+			if err := c.Status().Update(context.TODO(), crd); err != nil {
+				return migrated, err
+			}
+		}
+	}
+	return migrated, nil
+}
@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	cachev1beta1 "service-cache-operator/pkg/apis/cache/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SourceOfTruth is which side holds the configuration when a Service and its ServiceCache are different
+type SourceOfTruth string
+
+const (
+	// SourceOfTruthAnnotations makes the annotations of the Service authoritative, the ServiceCache follows them
+	SourceOfTruthAnnotations SourceOfTruth = "annotations"
+	// SourceOfTruthCRD makes the ServiceCache authoritative, the annotations of the Service follow it
+	SourceOfTruthCRD SourceOfTruth = "crd"
+	// SourceOfTruthBidirectional propagates each field from the side it has been changed on.
+	// A field changed on both sides is reported as a conflict, and is not overwritten.
+	SourceOfTruthBidirectional SourceOfTruth = "bidirectional"
+)
+
+// ParseSourceOfTruth returns the SourceOfTruth named value
+func ParseSourceOfTruth(value string) (SourceOfTruth, error) {
+	switch s := SourceOfTruth(value); s {
+	case SourceOfTruthAnnotations, SourceOfTruthCRD, SourceOfTruthBidirectional:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown source of truth %q, must be one of annotations, crd, bidirectional", value)
+}
+
+// KeyOfLastSynced is the key to save in a Service a hash of each configuration field, as it was when the Service and
+// its ServiceCache were last in sync. It tells which side changed a field since then.
+const KeyOfLastSynced = "operator.service-cache.github.io/last-synced"
+
+// The configuration fields shared by a Service and its ServiceCache
+const (
+	FieldCacheableByDefault   = "default"
+	FieldURLs                 = "URLs"
+	FieldMode                 = "mode"
+	FieldRules                = "rules"
+	FieldStaleWhileRevalidate = "stale-while-revalidate"
+	FieldStaleIfError         = "stale-if-error"
+)
+
+// ConfigFields are all the configuration fields shared by a Service and its ServiceCache
+var ConfigFields = []string{
+	FieldCacheableByDefault, FieldURLs, FieldMode, FieldRules, FieldStaleWhileRevalidate, FieldStaleIfError,
+}
+
+// SyncPlan tells which fields must be copied to bring a Service and its ServiceCache in sync
+type SyncPlan struct {
+	// ToServiceCache are the fields to copy from the annotations of the Service to the ServiceCache
+	ToServiceCache []string
+	// ToService are the fields to copy from the ServiceCache to the annotations of the Service
+	ToService []string
+	// Conflicts are the fields changed on both sides since they were last in sync
+	Conflicts []string
+}
+
+// PlanSync returns which fields must be copied, and in which direction, according to sourceOfTruth
+func PlanSync(sourceOfTruth SourceOfTruth, svc *corev1.Service, sc *cachev1beta1.ServiceCache) SyncPlan {
+	plan := SyncPlan{}
+	fromService := serviceFields(svc)
+	fromServiceCache := serviceCacheFields(sc)
+	lastSynced := getLastSynced(svc)
+
+	for _, f := range ConfigFields {
+		if fromService[f] == fromServiceCache[f] {
+			continue
+		}
+		switch sourceOfTruth {
+		case SourceOfTruthAnnotations:
+			plan.ToServiceCache = append(plan.ToServiceCache, f)
+		case SourceOfTruthCRD:
+			plan.ToService = append(plan.ToService, f)
+		default:
+			last, ok := lastSynced[f]
+			if !ok {
+				// never synced: the annotations are where the configuration comes from
+				plan.ToServiceCache = append(plan.ToServiceCache, f)
+				continue
+			}
+			serviceChanged := hashField(fromService[f]) != last
+			serviceCacheChanged := hashField(fromServiceCache[f]) != last
+			switch {
+			case serviceChanged && serviceCacheChanged:
+				plan.Conflicts = append(plan.Conflicts, f)
+			case serviceChanged:
+				plan.ToServiceCache = append(plan.ToServiceCache, f)
+			default:
+				plan.ToService = append(plan.ToService, f)
+			}
+		}
+	}
+	return plan
+}
+
+// RecordLastSynced saves in the annotations of svc the hash of the fields which are in sync with sc.
+// return true if svc has been changed
+func RecordLastSynced(svc *corev1.Service, sc *cachev1beta1.ServiceCache) bool {
+	fromService := serviceFields(svc)
+	fromServiceCache := serviceCacheFields(sc)
+	lastSynced := getLastSynced(svc)
+	if lastSynced == nil {
+		lastSynced = map[string]string{}
+	}
+
+	changed := false
+	for _, f := range ConfigFields {
+		if fromService[f] != fromServiceCache[f] {
+			continue
+		}
+		if h := hashField(fromService[f]); lastSynced[f] != h {
+			lastSynced[f] = h
+			changed = true
+		}
+	}
+	if !changed {
+		return false
+	}
+	value, _ := json.Marshal(lastSynced)
+	if svc.Annotations == nil {
+		svc.Annotations = map[string]string{}
+	}
+	svc.Annotations[KeyOfLastSynced] = string(value)
+	return true
+}
+
+func getLastSynced(svc *corev1.Service) map[string]string {
+	value, ok := svc.Annotations[KeyOfLastSynced]
+	if !ok {
+		return nil
+	}
+	lastSynced := map[string]string{}
+	if err := json.Unmarshal([]byte(value), &lastSynced); err != nil {
+		return nil
+	}
+	return lastSynced
+}
+
+func hashField(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:8])
+}
+
+// serviceFields returns the canonical value of each configuration field in the annotations of svc
+func serviceFields(svc *corev1.Service) map[string]string {
+	mode := cachev1beta1.CacheMode(strings.TrimSpace(svc.Annotations[KeyOfMode]))
+	if mode == "" {
+		mode = cachev1beta1.CacheModeProxy
+	}
+	rules := svc.Annotations[KeyOfRules]
+	if parsed, err := ParseRules(rules); err == nil {
+		rules = canonicalRules(parsed)
+	}
+	return map[string]string{
+		FieldCacheableByDefault:   strconv.FormatBool(strings.TrimSpace(svc.Annotations[KeyOfCacheableByDefault]) == "true"),
+		FieldURLs:                 canonicalURLs(ParseURLs(svc.Annotations[KeyOfCacheableUrls])),
+		FieldMode:                 string(mode),
+		FieldRules:                rules,
+		FieldStaleWhileRevalidate: canonicalDuration(svc.Annotations[KeyOfStaleWhileRevalidate]),
+		FieldStaleIfError:         canonicalDuration(svc.Annotations[KeyOfStaleIfError]),
+	}
+}
+
+// serviceCacheFields returns the canonical value of each configuration field in sc
+func serviceCacheFields(sc *cachev1beta1.ServiceCache) map[string]string {
+	return map[string]string{
+		FieldCacheableByDefault:   strconv.FormatBool(sc.Spec.CacheableByDefault),
+		FieldURLs:                 canonicalURLs(sc.Spec.URLs),
+		FieldMode:                 string(ModeOf(sc)),
+		FieldRules:                canonicalRules(sc.Spec.Rules),
+		FieldStaleWhileRevalidate: FormatDuration(sc.Spec.StaleWhileRevalidate),
+		FieldStaleIfError:         FormatDuration(sc.Spec.StaleIfError),
+	}
+}
+
+func canonicalURLs(urls []string) string {
+	sorted := append([]string(nil), urls...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+func canonicalRules(rules []cachev1beta1.CacheRule) string {
+	if len(rules) == 0 {
+		return ""
+	}
+	// the API server sets the default path type of the rules of a ServiceCache, the annotations may leave it empty
+	normalized := make([]cachev1beta1.CacheRule, len(rules))
+	for i, rule := range rules {
+		if rule.PathType == "" {
+			rule.PathType = cachev1beta1.PathMatchPrefix
+		}
+		normalized[i] = rule
+	}
+	value, _ := FormatRules(normalized)
+	return value
+}
+
+func canonicalDuration(value string) string {
+	d, err := ParseDuration(value)
+	if err != nil {
+		return value
+	}
+	return FormatDuration(d)
+}
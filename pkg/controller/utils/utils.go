@@ -1,11 +1,10 @@
 package utils
 
 import (
-	"sort"
-	"strconv"
+	"reflect"
 	"strings"
 
-	cachev1alpha1 "service-cache-operator/pkg/apis/cache/v1alpha1"
+	cachev1beta1 "service-cache-operator/pkg/apis/cache/v1beta1"
 
 	corev1 "k8s.io/api/core/v1"
 )
@@ -16,26 +15,35 @@ const KeyPrefix = "service-cache.github.io/"
 const KeyOfCacheableUrls = "service-cache.github.io/URLs"
 // KeyOfCacheableByDefault is the key for mapping cacheableByDefault configuration
 const KeyOfCacheableByDefault = "service-cache.github.io/default"
+// KeyOfMode is the key for mapping the mode configuration
+const KeyOfMode = "service-cache.github.io/mode"
+
+// IsAnnotated returns true if svc has any service cache annotation
+func IsAnnotated(svc *corev1.Service) bool {
+	for k := range svc.Annotations {
+		if strings.HasPrefix(k, KeyPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ModeOf returns the mode of sc, CacheModeProxy if it's not set
+func ModeOf(sc *cachev1beta1.ServiceCache) cachev1beta1.CacheMode {
+	if sc.Spec.Mode == "" {
+		return cachev1beta1.CacheModeProxy
+	}
+	return sc.Spec.Mode
+}
 
 // DiffServiceAndServiceCache is used to diff the configuration between Service and ServiceCache objects.
 // return true if has diff
-func DiffServiceAndServiceCache(svc *corev1.Service, sc *cachev1alpha1.ServiceCache) bool {
+func DiffServiceAndServiceCache(svc *corev1.Service, sc *cachev1beta1.ServiceCache) bool {
 	if svc == nil && sc == nil {
 		return false
 	}
 	if (svc == nil && sc != nil) || (svc != nil && sc == nil) {
 		return true
 	}
-  trimmedDefaultCacheable := strings.TrimSpace(svc.Annotations["service-cache.github.io/default"])
-	if trimmedDefaultCacheable != strconv.FormatBool(sc.Spec.CacheableByDefault) {
-		return true
-	}
-
-	trimmedCacheableURLsFromService := strings.TrimSpace(svc.Annotations["service-cache.github.io/URLs"])
-	urlsFromService := strings.TrimSuffix(strings.TrimPrefix(trimmedCacheableURLsFromService, "["), "]")
-	sliceOfUrlsFromService := strings.Split(urlsFromService, ",")
-	sort.Strings(sliceOfUrlsFromService)
-	sliceOfUrlsFromServiceCache := sc.Spec.URLs
-	sort.Strings(sliceOfUrlsFromServiceCache)
-	return strings.Join(sliceOfUrlsFromService, ",") != strings.Join(sliceOfUrlsFromServiceCache, ",")
+	return !reflect.DeepEqual(serviceFields(svc), serviceCacheFields(sc))
 }
@@ -0,0 +1,317 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	cachev1beta1 "service-cache-operator/pkg/apis/cache/v1beta1"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// knownKeys are the service cache annotations a Service may have
+var knownKeys = sets.NewString(KeyOfCacheableByDefault, KeyOfCacheableUrls, KeyOfMode, KeyOfRules,
+	KeyOfStaleWhileRevalidate, KeyOfStaleIfError)
+
+var supportedModes = []string{string(cachev1beta1.CacheModeProxy), string(cachev1beta1.CacheModeSidecar)}
+
+var supportedPathTypes = []string{
+	string(cachev1beta1.PathMatchExact),
+	string(cachev1beta1.PathMatchPrefix),
+	string(cachev1beta1.PathMatchRegex),
+}
+
+var supportedHeaderPolicies = []string{
+	string(cachev1beta1.HeaderPolicyRespect),
+	string(cachev1beta1.HeaderPolicyOverride),
+	string(cachev1beta1.HeaderPolicyStricter),
+}
+
+var supportedStorageTypes = []string{
+	string(cachev1beta1.StorageMemory),
+	string(cachev1beta1.StorageDisk),
+	string(cachev1beta1.StorageRedis),
+}
+
+// supportedMethods are the cacheable methods. A rule caching an unsafe method would also keep its requests from
+// invalidating the cached responses.
+var supportedMethods = sets.NewString("GET", "HEAD")
+
+// headerNameRegexp matches an HTTP header field name, see RFC 7230 section 3.2
+var headerNameRegexp = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// ValidateServiceAnnotations returns the errors in the service cache annotations of a Service
+func ValidateServiceAnnotations(annotations map[string]string) field.ErrorList {
+	allErrs := field.ErrorList{}
+	fldPath := field.NewPath("metadata", "annotations")
+
+	for k := range annotations {
+		if strings.HasPrefix(k, KeyPrefix) && !knownKeys.Has(k) {
+			allErrs = append(allErrs, field.NotSupported(fldPath.Key(k), k, knownKeys.List()))
+		}
+	}
+
+	spec := &cachev1beta1.ServiceCacheSpec{}
+	if value, ok := annotations[KeyOfCacheableByDefault]; ok {
+		switch strings.TrimSpace(value) {
+		case "true":
+			spec.CacheableByDefault = true
+		case "false":
+		default:
+			allErrs = append(allErrs, field.Invalid(fldPath.Key(KeyOfCacheableByDefault), value, "must be \"true\" or \"false\""))
+		}
+	}
+	if value, ok := annotations[KeyOfCacheableUrls]; ok {
+		spec.URLs = ParseURLs(value)
+	}
+	spec.Mode = cachev1beta1.CacheMode(strings.TrimSpace(annotations[KeyOfMode]))
+	rules, err := ParseRules(annotations[KeyOfRules])
+	if err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Key(KeyOfRules), annotations[KeyOfRules],
+			fmt.Sprintf("must be a JSON or YAML list of rules: %v", err)))
+	}
+	spec.Rules = rules
+	if spec.StaleWhileRevalidate, err = ParseDuration(annotations[KeyOfStaleWhileRevalidate]); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Key(KeyOfStaleWhileRevalidate), annotations[KeyOfStaleWhileRevalidate],
+			"must be a duration, e.g. \"30s\""))
+	}
+	if spec.StaleIfError, err = ParseDuration(annotations[KeyOfStaleIfError]); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Key(KeyOfStaleIfError), annotations[KeyOfStaleIfError],
+			"must be a duration, e.g. \"10m\""))
+	}
+
+	// report the errors of the configuration on the annotation it comes from
+	for _, e := range ValidateServiceCacheSpec(spec, field.NewPath("spec")) {
+		switch {
+		case strings.HasPrefix(e.Field, "spec.rules"):
+			e.Field = fldPath.Key(KeyOfRules).String() + strings.TrimPrefix(e.Field, "spec.rules")
+		case strings.HasPrefix(e.Field, "spec.urls"):
+			e.Field = fldPath.Key(KeyOfCacheableUrls).String() + strings.TrimPrefix(e.Field, "spec.urls")
+		case strings.HasPrefix(e.Field, "spec.mode"):
+			e.Field = fldPath.Key(KeyOfMode).String()
+		case strings.HasPrefix(e.Field, "spec.staleWhileRevalidate"):
+			e.Field = fldPath.Key(KeyOfStaleWhileRevalidate).String()
+		case strings.HasPrefix(e.Field, "spec.staleIfError"):
+			e.Field = fldPath.Key(KeyOfStaleIfError).String()
+		}
+		allErrs = append(allErrs, e)
+	}
+	return allErrs
+}
+
+// ValidateServiceCacheSpec returns the errors in the configuration of a ServiceCache
+func ValidateServiceCacheSpec(spec *cachev1beta1.ServiceCacheSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if spec.Mode != "" && spec.Mode != cachev1beta1.CacheModeProxy && spec.Mode != cachev1beta1.CacheModeSidecar {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("mode"), spec.Mode, supportedModes))
+	}
+
+	for i, u := range spec.URLs {
+		u = strings.TrimSpace(u)
+		if u != "" && !strings.HasPrefix(u, "/") {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("urls").Index(i), u, "must start with \"/\""))
+		}
+	}
+
+	seen := map[string]int{}
+	for i := range spec.Rules {
+		rule := &spec.Rules[i]
+		rulePath := fldPath.Child("rules").Index(i)
+		allErrs = append(allErrs, validateCacheRule(rule, rulePath)...)
+
+		// two rules matching the same requests are conflicting, the second one would never apply
+		key := string(rule.PathType) + " " + rule.Path
+		if rule.PathType == "" {
+			key = string(cachev1beta1.PathMatchPrefix) + " " + rule.Path
+		}
+		if j, ok := seen[key]; ok && methodsOverlap(spec.Rules[j].Methods, rule.Methods) {
+			allErrs = append(allErrs, field.Duplicate(rulePath, fmt.Sprintf("conflicts with rule %d: same path and methods", j)))
+			continue
+		}
+		seen[key] = i
+	}
+
+	if spec.StaleWhileRevalidate != nil && spec.StaleWhileRevalidate.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("staleWhileRevalidate"),
+			spec.StaleWhileRevalidate.Duration.String(), "must not be negative"))
+	}
+	if spec.StaleIfError != nil && spec.StaleIfError.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("staleIfError"), spec.StaleIfError.Duration.String(),
+			"must not be negative"))
+	}
+
+	switch spec.HeaderPolicy {
+	case "", cachev1beta1.HeaderPolicyRespect, cachev1beta1.HeaderPolicyOverride, cachev1beta1.HeaderPolicyStricter:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("headerPolicy"), spec.HeaderPolicy, supportedHeaderPolicies))
+	}
+	if spec.Storage != nil {
+		allErrs = append(allErrs, validateCacheStorage(spec.Storage, fldPath.Child("storage"))...)
+	}
+	if spec.CacheKey != nil {
+		allErrs = append(allErrs, validateCacheKey(spec.CacheKey, fldPath.Child("cacheKey"))...)
+	}
+	if spec.Coalescing != nil && spec.Coalescing.WaitTimeout != nil && spec.Coalescing.WaitTimeout.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("coalescing", "waitTimeout"),
+			spec.Coalescing.WaitTimeout.Duration.String(), "must be positive"))
+	}
+	if spec.Invalidation != nil && spec.Invalidation.Locations && !spec.Invalidation.UnsafeMethods {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("invalidation", "locations"), true,
+			"requires unsafeMethods"))
+	}
+	return allErrs
+}
+
+func validateCacheStorage(storage *cachev1beta1.CacheStorage, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	switch storage.Type {
+	case "", cachev1beta1.StorageMemory, cachev1beta1.StorageDisk, cachev1beta1.StorageRedis:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("type"), storage.Type, supportedStorageTypes))
+	}
+	if storage.MaxSize != nil && storage.MaxSize.Sign() <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("maxSize"), storage.MaxSize.String(), "must be positive"))
+	}
+
+	if storage.Redis == nil {
+		if storage.Type == cachev1beta1.StorageRedis {
+			allErrs = append(allErrs, field.Required(fldPath.Child("redis"), "the Redis storage requires a server"))
+		}
+		return allErrs
+	}
+	redisPath := fldPath.Child("redis")
+	if _, _, err := net.SplitHostPort(storage.Redis.Address); err != nil {
+		allErrs = append(allErrs, field.Invalid(redisPath.Child("address"), storage.Redis.Address, "must be host:port"))
+	}
+	if storage.Redis.Database < 0 {
+		allErrs = append(allErrs, field.Invalid(redisPath.Child("database"), storage.Redis.Database, "must not be negative"))
+	}
+	if ref := storage.Redis.PasswordSecretRef; ref != nil {
+		if ref.Name == "" {
+			allErrs = append(allErrs, field.Required(redisPath.Child("passwordSecretRef", "name"), ""))
+		}
+		if ref.Key == "" {
+			allErrs = append(allErrs, field.Required(redisPath.Child("passwordSecretRef", "key"), ""))
+		}
+	}
+	return allErrs
+}
+
+func validateCacheKey(key *cachev1beta1.CacheKey, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if key.Query != nil {
+		allErrs = append(allErrs, validateQueryNames(key.Query.Include, fldPath.Child("query", "include"))...)
+		allErrs = append(allErrs, validateQueryNames(key.Query.Exclude, fldPath.Child("query", "exclude"))...)
+	}
+	for i, h := range key.Headers {
+		if !headerNameRegexp.MatchString(h.Name) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("headers").Index(i).Child("name"), h.Name, "must be an HTTP header name"))
+		}
+	}
+	// a cookie name is a token, like a header name, see RFC 6265 section 4.1.1
+	for i, c := range key.Cookies {
+		if !headerNameRegexp.MatchString(c.Name) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("cookies").Index(i).Child("name"), c.Name, "must be a cookie name"))
+		}
+	}
+	return allErrs
+}
+
+// validateQueryNames returns the errors in a list of query parameter names, which may end with "*"
+func validateQueryNames(names []string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for i, name := range names {
+		if prefix := strings.TrimSuffix(name, "*"); prefix == "" || strings.Contains(prefix, "*") {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i), name, "must be a parameter name, or a prefix ending with \"*\""))
+		}
+	}
+	return allErrs
+}
+
+// ValidateServiceCachePurgeSpec returns the errors in the spec of a ServiceCachePurge
+func ValidateServiceCachePurgeSpec(spec *cachev1beta1.ServiceCachePurgeSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if spec.ServiceCacheName == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("serviceCacheName"), ""))
+	}
+	if !spec.All && len(spec.Keys) == 0 && len(spec.PathPrefixes) == 0 && len(spec.PathRegexes) == 0 && len(spec.Tags) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath, "at least one of all, keys, pathPrefixes, pathRegexes or tags is required"))
+	}
+	for i, k := range spec.Keys {
+		if !strings.HasPrefix(k, "/") {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("keys").Index(i), k, "must start with \"/\""))
+		}
+	}
+	for i, prefix := range spec.PathPrefixes {
+		if !strings.HasPrefix(prefix, "/") {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("pathPrefixes").Index(i), prefix, "must start with \"/\""))
+		}
+	}
+	for i, expr := range spec.PathRegexes {
+		if _, err := regexp.Compile(expr); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("pathRegexes").Index(i), expr, err.Error()))
+		}
+	}
+	for i, tag := range spec.Tags {
+		if tag == "" || strings.ContainsAny(tag, " \t") {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("tags").Index(i), tag, "must be a non-empty word without spaces"))
+		}
+	}
+	return allErrs
+}
+
+func validateCacheRule(rule *cachev1beta1.CacheRule, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	switch rule.PathType {
+	case "", cachev1beta1.PathMatchExact, cachev1beta1.PathMatchPrefix:
+		if !strings.HasPrefix(rule.Path, "/") {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("path"), rule.Path, "must start with \"/\""))
+		}
+	case cachev1beta1.PathMatchRegex:
+		if rule.Path == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("path"), ""))
+		} else if _, err := regexp.Compile(rule.Path); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("path"), rule.Path, err.Error()))
+		}
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("pathType"), rule.PathType, supportedPathTypes))
+	}
+
+	for i, m := range rule.Methods {
+		if !supportedMethods.Has(strings.ToUpper(m)) {
+			allErrs = append(allErrs, field.NotSupported(fldPath.Child("methods").Index(i), m, supportedMethods.List()))
+		}
+	}
+	if rule.TTL != nil && rule.TTL.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("ttl"), rule.TTL.Duration.String(), "must not be negative"))
+	}
+	for i, h := range rule.Vary {
+		if !headerNameRegexp.MatchString(h) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("vary").Index(i), h, "must be an HTTP header name"))
+		}
+	}
+	return allErrs
+}
+
+// methodsOverlap returns true if a request method can be in both method lists, empty meaning GET and HEAD
+func methodsOverlap(a, b []string) bool {
+	normalize := func(methods []string) sets.String {
+		if len(methods) == 0 {
+			return sets.NewString("GET", "HEAD")
+		}
+		s := sets.NewString()
+		for _, m := range methods {
+			s.Insert(strings.ToUpper(m))
+		}
+		return s
+	}
+	return normalize(a).HasAny(normalize(b).List()...)
+}
@@ -0,0 +1,100 @@
+// Package httpcache implements the HTTP caching rules of RFC 9111 for a shared cache: which responses may be stored,
+// for how long they are fresh, and which requests accept them.
+package httpcache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Directives are the directives of the Cache-Control header fields of a message, by lowercase name.
+// A directive without argument has an empty value.
+type Directives map[string]string
+
+// ParseCacheControl returns the directives of the Cache-Control header fields in header
+func ParseCacheControl(header http.Header) Directives {
+	directives := Directives{}
+	for _, value := range header[http.CanonicalHeaderKey("Cache-Control")] {
+		for _, part := range splitDirectives(value) {
+			name, arg := part, ""
+			if i := strings.IndexByte(part, '='); i >= 0 {
+				name, arg = part[:i], strings.Trim(strings.TrimSpace(part[i+1:]), `"`)
+			}
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			// the first occurrence of a directive wins
+			if _, ok := directives[name]; !ok {
+				directives[name] = arg
+			}
+		}
+	}
+	return directives
+}
+
+// splitDirectives splits a Cache-Control value on the commas which are not in a quoted string,
+// e.g. `no-cache="Set-Cookie, Set-Cookie2"`
+func splitDirectives(value string) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				parts = append(parts, value[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, value[start:])
+}
+
+// Has returns true if the directive name is present
+func (d Directives) Has(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+// Seconds returns the delta-seconds argument of the directive name, false if it's missing or invalid.
+// A value too large is capped, see RFC 9111 section 1.2.2.
+func (d Directives) Seconds(name string) (time.Duration, bool) {
+	value, ok := d[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+			return maxDelta, true
+		}
+		return 0, false
+	}
+	if seconds > uint64(maxDelta/time.Second) {
+		return maxDelta, true
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// maxDelta is the largest delta-seconds value, 2^31 seconds
+const maxDelta = (1 << 31) * time.Second
+
+// hasPragmaNoCache returns true if header has "Pragma: no-cache" and no Cache-Control, see RFC 9111 section 5.4
+func hasPragmaNoCache(header http.Header) bool {
+	if len(header["Cache-Control"]) > 0 {
+		return false
+	}
+	for _, value := range header["Pragma"] {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), "no-cache") {
+				return true
+			}
+		}
+	}
+	return false
+}
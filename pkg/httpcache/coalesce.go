@@ -0,0 +1,63 @@
+package httpcache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultCoalesceTimeout is how long a request waits for a concurrent request to the origin when
+// Options.CoalesceTimeout is not set
+const DefaultCoalesceTimeout = 5 * time.Second
+
+// flight is a request to the origin for a cached response, shared by the concurrent requests for the same response
+type flight struct {
+	done chan struct{}
+	// e is the response of the origin, nil if it's not cacheable so it cannot be shared with the waiters
+	e *entry
+}
+
+// wait returns the response of the flight once it lands, or false if the timeout expires or ctx is canceled first
+func (f *flight) wait(ctx context.Context, timeout time.Duration) (*entry, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-f.done:
+		return f.e, true
+	case <-timer.C:
+		return nil, false
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// flightGroup tracks the requests to the origin in flight, by cache key
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// join returns the flight of key, and true if there was none: the caller then leads the flight, it must send the
+// request to the origin and land the flight
+func (g *flightGroup) join(key string) (*flight, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if f, ok := g.flights[key]; ok {
+		return f, false
+	}
+	if g.flights == nil {
+		g.flights = map[string]*flight{}
+	}
+	f := &flight{done: make(chan struct{})}
+	g.flights[key] = f
+	return f, true
+}
+
+// land ends the flight of key, sharing e with its waiters
+func (g *flightGroup) land(key string, f *flight, e *entry) {
+	g.mu.Lock()
+	delete(g.flights, key)
+	g.mu.Unlock()
+	f.e = e
+	close(f.done)
+}
@@ -0,0 +1,147 @@
+package httpcache
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingOrigin holds its first request until released, and answers each request with its number
+type blockingOrigin struct {
+	cacheControl string
+	started      chan struct{}
+	release      chan struct{}
+
+	mu       sync.Mutex
+	requests int
+}
+
+func newBlockingOrigin(cacheControl string) *blockingOrigin {
+	return &blockingOrigin{cacheControl: cacheControl, started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (o *blockingOrigin) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	o.mu.Lock()
+	o.requests++
+	n := o.requests
+	o.mu.Unlock()
+	if n == 1 {
+		close(o.started)
+		<-o.release
+	}
+	if o.cacheControl != "" {
+		w.Header().Set("Cache-Control", o.cacheControl)
+	}
+	fmt.Fprint(w, n)
+}
+
+func (o *blockingOrigin) received() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.requests
+}
+
+// serveConcurrently sends n GET requests to target through h while the first request to the origin is blocked, and
+// returns the responses once the origin is released
+func serveConcurrently(h http.Handler, o *blockingOrigin, target string, n int) []*httptest.ResponseRecorder {
+	responses := make([]*httptest.ResponseRecorder, n)
+	var wg sync.WaitGroup
+	wg.Add(n)
+	serveOne := func(i int) {
+		defer wg.Done()
+		responses[i] = serve(h, http.MethodGet, target, nil)
+	}
+	go serveOne(0)
+	<-o.started
+	for i := 1; i < n; i++ {
+		go serveOne(i)
+	}
+	// let the concurrent requests join the one in flight
+	time.Sleep(20 * time.Millisecond)
+	close(o.release)
+	wg.Wait()
+	return responses
+}
+
+func TestCoalesce(t *testing.T) {
+	o := newBlockingOrigin("")
+	h := cachingHandler(o, Options{TTL: time.Minute, Policy: PolicyStricter, Coalesce: true})
+
+	responses := serveConcurrently(h, o, "/item", 10)
+	if n := o.received(); n != 1 {
+		t.Errorf("the origin received %d requests, want 1", n)
+	}
+	assertResponse(t, responses[0], http.StatusOK, "MISS", "1")
+	for _, w := range responses[1:] {
+		// a request arriving after the response is cached gets a HIT
+		if status := w.Header().Get(HeaderCacheStatus); status != "COALESCED" && status != "HIT" {
+			t.Errorf("cache status %s, want COALESCED", status)
+		}
+		if w.Body.String() != "1" {
+			t.Errorf("body %q, want the response of the first request", w.Body.String())
+		}
+	}
+}
+
+func TestCoalesceUncacheable(t *testing.T) {
+	o := newBlockingOrigin("no-store")
+	h := cachingHandler(o, Options{TTL: time.Minute, Policy: PolicyStricter, Coalesce: true})
+
+	// a response which cannot be cached is not shared, the waiting requests are forwarded
+	responses := serveConcurrently(h, o, "/item", 5)
+	if n := o.received(); n != 5 {
+		t.Errorf("the origin received %d requests, want 5", n)
+	}
+	seen := map[string]bool{}
+	for _, w := range responses {
+		if status := w.Header().Get(HeaderCacheStatus); status != "MISS" {
+			t.Errorf("cache status %s, want MISS", status)
+		}
+		if seen[w.Body.String()] {
+			t.Errorf("the response %q has been shared", w.Body.String())
+		}
+		seen[w.Body.String()] = true
+	}
+}
+
+func TestCoalesceTimeout(t *testing.T) {
+	o := newBlockingOrigin("")
+	h := cachingHandler(o, Options{TTL: time.Minute, Policy: PolicyStricter, Coalesce: true, CoalesceTimeout: 10 * time.Millisecond})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serve(h, http.MethodGet, "/item", nil)
+	}()
+	<-o.started
+	// the request in flight is too slow, the waiting request is forwarded
+	assertResponse(t, serve(h, http.MethodGet, "/item", nil), http.StatusOK, "MISS", "2")
+	close(o.release)
+	<-done
+}
+
+func TestCoalesceCanceled(t *testing.T) {
+	o := newBlockingOrigin("")
+	h := cachingHandler(o, Options{TTL: time.Minute, Policy: PolicyStricter, Coalesce: true})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serve(h, http.MethodGet, "/item", nil)
+	}()
+	<-o.started
+	// the client of a waiting request is gone, the request is not forwarded
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/item", nil).WithContext(ctx)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	close(o.release)
+	<-done
+	if n := o.received(); n != 1 {
+		t.Errorf("the origin received %d requests, want 1", n)
+	}
+}
@@ -0,0 +1,133 @@
+package httpcache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy is how the caching headers of the origin combine with the TTL configured in the cache
+type Policy string
+
+const (
+	// PolicyRespect caches the responses as told by the caching headers of the origin and of the clients.
+	// The configured TTL only applies to the responses without explicit freshness.
+	PolicyRespect Policy = "Respect"
+	// PolicyOverride caches the responses for the configured TTL, whatever their headers
+	PolicyOverride Policy = "Override"
+	// PolicyStricter caches the responses for the configured TTL, unless the headers are stricter: a shorter
+	// freshness, no-store, private... It's the default.
+	PolicyStricter Policy = "Stricter"
+)
+
+// Storable returns true if a shared cache may store the response to req, see RFC 9111 section 3.
+// The cacheable methods and status codes are decided by the caller.
+func Storable(req *http.Request, header http.Header) bool {
+	reqDirectives := ParseCacheControl(req.Header)
+	directives := ParseCacheControl(header)
+	if reqDirectives.Has("no-store") || directives.Has("no-store") || directives.Has("private") {
+		return false
+	}
+	// the response would have to be revalidated before each use
+	if directives.Has("no-cache") || hasPragmaNoCache(header) {
+		return false
+	}
+	// a response to an authenticated request is only shared if the origin explicitly allows it, see section 3.5
+	if req.Header.Get("Authorization") != "" &&
+		!directives.Has("public") && !directives.Has("s-maxage") && !directives.Has("must-revalidate") {
+		return false
+	}
+	// the cookies of a client must not be handed to the others
+	if _, ok := header["Set-Cookie"]; ok {
+		return false
+	}
+	for _, value := range header["Vary"] {
+		for _, name := range strings.Split(value, ",") {
+			if strings.TrimSpace(name) == "*" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// FreshnessLifetime returns how long a response with header is fresh after its generation by the origin, and false if
+// the response has no explicit freshness, see RFC 9111 section 4.2.1
+func FreshnessLifetime(header http.Header) (time.Duration, bool) {
+	directives := ParseCacheControl(header)
+	if lifetime, ok := directives.Seconds("s-maxage"); ok {
+		return lifetime, true
+	}
+	if lifetime, ok := directives.Seconds("max-age"); ok {
+		return lifetime, true
+	}
+	if values, ok := header["Expires"]; ok {
+		expires, err := http.ParseTime(firstValue(values))
+		if err != nil {
+			// an invalid Expires means already expired
+			return 0, true
+		}
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			return 0, true
+		}
+		if lifetime := expires.Sub(date); lifetime > 0 {
+			return lifetime, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// InitialAge returns the age of a response with header when it's received, the corrected_initial_age of RFC 9111
+// section 4.2.3. requestTime and responseTime are when the request was sent and the response received.
+func InitialAge(header http.Header, requestTime, responseTime time.Time) time.Duration {
+	apparentAge := time.Duration(0)
+	if date, err := http.ParseTime(header.Get("Date")); err == nil {
+		if d := responseTime.Sub(date); d > 0 {
+			apparentAge = d
+		}
+	}
+	ageValue := time.Duration(0)
+	if seconds, err := strconv.ParseUint(strings.TrimSpace(header.Get("Age")), 10, 32); err == nil {
+		ageValue = time.Duration(seconds) * time.Second
+	}
+	correctedAgeValue := ageValue + responseTime.Sub(requestTime)
+	if apparentAge > correctedAgeValue {
+		return apparentAge
+	}
+	return correctedAgeValue
+}
+
+// TTL returns how long the response to req, received at responseTime, is served from the cache according to policy,
+// and false if it must not be stored. ttl is the TTL configured in the cache.
+func TTL(policy Policy, ttl time.Duration, req *http.Request, header http.Header, requestTime, responseTime time.Time) (time.Duration, bool) {
+	if policy == PolicyOverride {
+		return ttl, ttl > 0
+	}
+	if !Storable(req, header) {
+		return 0, false
+	}
+
+	lifetime, explicit := FreshnessLifetime(header)
+	age := InitialAge(header, requestTime, responseTime)
+	switch {
+	case !explicit:
+		// the configured TTL is the heuristic freshness of the responses without caching headers
+	case policy == PolicyRespect:
+		ttl = lifetime - age
+	default:
+		if remaining := lifetime - age; remaining < ttl {
+			ttl = remaining
+		}
+	}
+	return ttl, ttl > 0
+}
+
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
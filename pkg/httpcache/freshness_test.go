@@ -0,0 +1,215 @@
+package httpcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// headerOf returns the header of the name and value pairs in kv
+func headerOf(kv ...string) http.Header {
+	header := http.Header{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		header.Add(kv[i], kv[i+1])
+	}
+	return header
+}
+
+func TestParseCacheControl(t *testing.T) {
+	directives := ParseCacheControl(headerOf(
+		"Cache-Control", `Max-Age=60, no-cache="Set-Cookie, Set-Cookie2"`,
+		"Cache-Control", "max-age=30, public",
+	))
+	if value, ok := directives.Seconds("max-age"); !ok || value != time.Minute {
+		t.Errorf("max-age = %v, %v, want the first occurrence, 1m", value, ok)
+	}
+	if directives["no-cache"] != "Set-Cookie, Set-Cookie2" {
+		t.Errorf("no-cache = %q, want the quoted list", directives["no-cache"])
+	}
+	if !directives.Has("public") {
+		t.Error("public is missing")
+	}
+	if value, ok := ParseCacheControl(headerOf("Cache-Control", "max-age=99999999999")).Seconds("max-age"); !ok || value != maxDelta {
+		t.Errorf("a too large max-age = %v, %v, want it capped to %v", value, ok, maxDelta)
+	}
+	if _, ok := ParseCacheControl(headerOf("Cache-Control", "max-age=soon")).Seconds("max-age"); ok {
+		t.Error("an invalid max-age is accepted")
+	}
+}
+
+func TestStorable(t *testing.T) {
+	tests := []struct {
+		name      string
+		reqHeader http.Header
+		header    http.Header
+		want      bool
+	}{
+		{"no headers", nil, nil, true},
+		{"max-age", nil, headerOf("Cache-Control", "max-age=60"), true},
+		{"no-store", nil, headerOf("Cache-Control", "no-store"), false},
+		{"request no-store", headerOf("Cache-Control", "no-store"), nil, false},
+		{"private", nil, headerOf("Cache-Control", "private, max-age=60"), false},
+		{"no-cache", nil, headerOf("Cache-Control", "no-cache"), false},
+		{"pragma no-cache", nil, headerOf("Pragma", "no-cache"), false},
+		{"pragma with cache-control", nil, headerOf("Pragma", "no-cache", "Cache-Control", "max-age=60"), true},
+		{"vary star", nil, headerOf("Vary", "Accept, *"), false},
+		{"vary", nil, headerOf("Vary", "Accept"), true},
+		{"set-cookie", nil, headerOf("Cache-Control", "public, max-age=60", "Set-Cookie", "session=42"), false},
+		{"authorization", headerOf("Authorization", "Bearer x"), headerOf("Cache-Control", "max-age=60"), false},
+		{"authorization public", headerOf("Authorization", "Bearer x"), headerOf("Cache-Control", "public"), true},
+		{"authorization s-maxage", headerOf("Authorization", "Bearer x"), headerOf("Cache-Control", "s-maxage=60"), true},
+		{"authorization must-revalidate", headerOf("Authorization", "Bearer x"), headerOf("Cache-Control", "must-revalidate"), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range test.reqHeader {
+				req.Header[k] = v
+			}
+			if got := Storable(req, test.header); got != test.want {
+				t.Errorf("Storable = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFreshnessLifetime(t *testing.T) {
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		header   http.Header
+		want     time.Duration
+		explicit bool
+	}{
+		{"none", nil, 0, false},
+		{"max-age", headerOf("Cache-Control", "max-age=60"), time.Minute, true},
+		{"s-maxage wins", headerOf("Cache-Control", "max-age=60, s-maxage=10"), 10 * time.Second, true},
+		{"max-age wins over expires", headerOf("Cache-Control", "max-age=60",
+			"Date", date.Format(http.TimeFormat), "Expires", date.Add(time.Hour).Format(http.TimeFormat)), time.Minute, true},
+		{"expires", headerOf("Date", date.Format(http.TimeFormat),
+			"Expires", date.Add(time.Hour).Format(http.TimeFormat)), time.Hour, true},
+		{"expires in the past", headerOf("Date", date.Format(http.TimeFormat),
+			"Expires", date.Add(-time.Hour).Format(http.TimeFormat)), 0, true},
+		{"invalid expires", headerOf("Date", date.Format(http.TimeFormat), "Expires", "0"), 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, explicit := FreshnessLifetime(test.header)
+			if got != test.want || explicit != test.explicit {
+				t.Errorf("FreshnessLifetime = %v, %v, want %v, %v", got, explicit, test.want, test.explicit)
+			}
+		})
+	}
+}
+
+func TestInitialAge(t *testing.T) {
+	requestTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	responseTime := requestTime.Add(2 * time.Second)
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"response delay", nil, 2 * time.Second},
+		{"age", headerOf("Age", "30"), 32 * time.Second},
+		{"date", headerOf("Date", requestTime.Add(-time.Minute).Format(http.TimeFormat)), 62 * time.Second},
+		{"date in the future", headerOf("Date", requestTime.Add(time.Hour).Format(http.TimeFormat)), 2 * time.Second},
+		{"invalid age", headerOf("Age", "-1"), 2 * time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := InitialAge(test.header, requestTime, responseTime); got != test.want {
+				t.Errorf("InitialAge = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTTL(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		policy    Policy
+		ttl       time.Duration
+		reqHeader http.Header
+		header    http.Header
+		want      time.Duration
+		storable  bool
+	}{
+		{"override ignores the headers", PolicyOverride, time.Minute, nil, headerOf("Cache-Control", "no-store"), time.Minute, true},
+		{"override without ttl", PolicyOverride, 0, nil, headerOf("Cache-Control", "max-age=60"), 0, false},
+		{"respect the origin", PolicyRespect, time.Minute, nil, headerOf("Cache-Control", "max-age=600"), 10 * time.Minute, true},
+		{"respect the age", PolicyRespect, time.Minute, nil, headerOf("Cache-Control", "max-age=600", "Age", "60"), 9 * time.Minute, true},
+		{"respect without freshness", PolicyRespect, time.Minute, nil, nil, time.Minute, true},
+		{"respect no-store", PolicyRespect, time.Minute, nil, headerOf("Cache-Control", "no-store"), 0, false},
+		{"respect expired", PolicyRespect, time.Minute, nil, headerOf("Cache-Control", "max-age=60", "Age", "60"), 0, false},
+		{"stricter keeps the ttl", PolicyStricter, time.Minute, nil, headerOf("Cache-Control", "max-age=600"), time.Minute, true},
+		{"stricter shortens the ttl", PolicyStricter, time.Minute, nil, headerOf("Cache-Control", "max-age=30"), 30 * time.Second, true},
+		{"stricter without freshness", PolicyStricter, time.Minute, nil, nil, time.Minute, true},
+		{"stricter private", PolicyStricter, time.Minute, nil, headerOf("Cache-Control", "private"), 0, false},
+		{"stricter request no-store", PolicyStricter, time.Minute, headerOf("Cache-Control", "no-store"), nil, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range test.reqHeader {
+				req.Header[k] = v
+			}
+			got, storable := TTL(test.policy, test.ttl, req, test.header, now, now)
+			if got != test.want || storable != test.storable {
+				t.Errorf("TTL = %v, %v, want %v, %v", got, storable, test.want, test.storable)
+			}
+		})
+	}
+}
+
+func TestAcceptable(t *testing.T) {
+	tests := []struct {
+		name      string
+		reqHeader http.Header
+		age       time.Duration
+		remaining time.Duration
+		want      bool
+	}{
+		{"no headers", nil, time.Minute, time.Minute, true},
+		{"no-cache", headerOf("Cache-Control", "no-cache"), 0, time.Minute, false},
+		{"pragma no-cache", headerOf("Pragma", "no-cache"), 0, time.Minute, false},
+		{"max-age", headerOf("Cache-Control", "max-age=60"), 30 * time.Second, time.Minute, true},
+		{"max-age exceeded", headerOf("Cache-Control", "max-age=60"), 2 * time.Minute, time.Minute, false},
+		{"min-fresh", headerOf("Cache-Control", "min-fresh=30"), 0, time.Minute, true},
+		{"min-fresh not met", headerOf("Cache-Control", "min-fresh=120"), 0, time.Minute, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range test.reqHeader {
+				req.Header[k] = v
+			}
+			if got := Acceptable(req, test.age, test.remaining); got != test.want {
+				t.Errorf("Acceptable = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestVaryKey(t *testing.T) {
+	header := headerOf("Vary", "accept-encoding, Accept")
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("Accept-Encoding", "gzip")
+	other := httptest.NewRequest(http.MethodGet, "/", nil)
+	other.Header.Set("Accept", "text/html")
+
+	if VaryKey(header, req) == VaryKey(header, other) {
+		t.Error("the requests with different Accept-Encoding headers have the same key")
+	}
+	other.Header.Set("Accept-Encoding", "gzip")
+	other.Header.Set("Cookie", "a=b")
+	if VaryKey(header, req) != VaryKey(header, other) {
+		t.Error("the requests with the same varying headers have different keys")
+	}
+	if VaryKey(nil, req) != "" {
+		t.Errorf("VaryKey without Vary = %q, want empty", VaryKey(nil, req))
+	}
+}
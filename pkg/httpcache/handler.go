@@ -0,0 +1,563 @@
+package httpcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"service-cache-operator/pkg/store"
+)
+
+// HeaderCacheStatus is the response header telling clients how the response was served:
+// HIT from the cache, REVALIDATED from the cache after asking the origin, STALE from the cache after it expired,
+// COALESCED from the response to a concurrent request, MISS from the origin
+const HeaderCacheStatus = "X-Cache"
+
+// DefaultStaleRetention is how long a stale response with validators is kept to be revalidated when
+// Handler.StaleRetention is not set
+const DefaultStaleRetention = 10 * time.Minute
+
+// Options tell how the response to a request is cached
+type Options struct {
+	// Key identifies the response in the store
+	Key string
+	// TTL is the configured freshness of the response, combined with its caching headers according to Policy
+	TTL time.Duration
+	// Policy is how the caching headers combine with TTL
+	Policy Policy
+	// StaleWhileRevalidate is how long the response is still served after it expires, while it's refreshed in the
+	// background
+	StaleWhileRevalidate time.Duration
+	// StaleIfError is how long the response is still served after it expires, when the origin answers with a 5xx
+	// error, e.g. 502 Bad Gateway when it has no ready endpoints
+	StaleIfError time.Duration
+	// Coalesce makes the concurrent requests for the response wait for a single request to the origin, and get its
+	// response if it's cacheable
+	Coalesce bool
+	// CoalesceTimeout is how long a request waits for a concurrent request to the origin before being forwarded
+	// itself, DefaultCoalesceTimeout if zero
+	CoalesceTimeout time.Duration
+	// Rule names the configuration the request matched, for the metrics
+	Rule string
+	// Invalidate forwards the request without caching its response, and deletes the cached responses of its path when
+	// the origin answers with a success, see RFC 9111 section 4.4. It's meant for the unsafe methods, e.g. POST.
+	Invalidate bool
+	// InvalidateLocations also deletes the cached responses of the paths in the Location and Content-Location headers
+	// of the response, when they are on the host of the request
+	InvalidateLocations bool
+}
+
+// MatchFunc returns how the response to req is cached, and false if it's not cacheable
+type MatchFunc func(req *http.Request) (Options, bool)
+
+// Handler answers the cacheable requests from a store of the responses of an origin handler.
+// A stale response with an ETag or a Last-Modified header is revalidated with a conditional request to the origin,
+// and the conditional requests of the clients are answered from the cache with 304 Not Modified.
+type Handler struct {
+	// ErrorLog logs the errors of the store, which are served as cache misses. The log package's standard logger is
+	// used if it's nil.
+	ErrorLog *log.Logger
+	// StaleRetention is how long a stale response with validators is kept to be revalidated,
+	// DefaultStaleRetention if zero
+	StaleRetention time.Duration
+	// Metrics receives the events of the handler, if not nil
+	Metrics Metrics
+
+	origin http.Handler
+	match  MatchFunc
+
+	mu    sync.RWMutex
+	store store.Store
+
+	// flights are the requests to the origin in flight, waited for by the concurrent requests for the same response
+	flights flightGroup
+
+	purgesMu sync.Mutex
+	// purges are the recent purges, in order
+	purges []*compiledPurge
+
+	// paths are the keys of the cached responses by path, for the invalidations
+	paths pathIndex
+
+	invalidationsMu sync.RWMutex
+	// invalidated are the recent invalidations by path, their cached responses are not served
+	invalidated map[string]*invalidation
+	// pending are the invalidated paths whose cached responses are waiting to be deleted in the background
+	pending map[string]bool
+	// invalidating is true while a goroutine deletes the cached responses of the pending paths
+	invalidating bool
+	// pruned is when the old invalidations were last forgotten
+	pruned time.Time
+	// indexing counts the stores being indexed
+	indexing int
+}
+
+// NewHandler returns a Handler caching in s the responses of origin to the requests accepted by match. The responses
+// already in s are indexed in the background.
+func NewHandler(origin http.Handler, match MatchFunc, s store.Store) *Handler {
+	h := &Handler{origin: origin, match: match, store: s}
+	go h.indexStore(s)
+	return h
+}
+
+// SetStore replaces the store of the cached responses, and returns the previous one for the caller to close it. The
+// responses already in s are indexed in the background.
+func (h *Handler) SetStore(s store.Store) store.Store {
+	h.mu.Lock()
+	previous := h.store
+	h.store = s
+	h.paths.reset()
+	h.mu.Unlock()
+	go h.indexStore(s)
+	return previous
+}
+
+// Store returns the store of the cached responses
+func (h *Handler) Store() store.Store {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.store
+}
+
+// entry is a cached response, as saved in the store
+type entry struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	// Stored is when the response was received from the origin
+	Stored time.Time
+	// InitialAge is the age of the response when it was received
+	InitialAge time.Duration
+	Expires    time.Time
+	// VaryKey are the values of the request headers the response varies on
+	VaryKey string
+	// URL is the path and query of the request, to purge the response by URL
+	URL string
+	// Tags are the surrogate keys of the response, to purge it by tag
+	Tags []string
+	// Retained is when the store drops the response, stale or not, zero if never
+	Retained time.Time
+}
+
+// path returns the path of the request of e
+func (e *entry) path() string {
+	if i := strings.Index(e.URL, "?"); i >= 0 {
+		return e.URL[:i]
+	}
+	return e.URL
+}
+
+func (e *entry) age(now time.Time) time.Duration {
+	return e.InitialAge + now.Sub(e.Stored)
+}
+
+func (e *entry) hasValidators() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+// ServeHTTP serves req from the cache if possible, otherwise forwards it to the origin
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	opts, ok := h.match(req)
+	if !ok {
+		h.origin.ServeHTTP(w, req)
+		return
+	}
+	if opts.Invalidate {
+		h.origin.ServeHTTP(&invalidatingWriter{ResponseWriter: w, h: h, req: req, opts: opts}, req)
+		return
+	}
+
+	s := h.Store()
+	now := time.Now()
+	e := h.lookup(s, opts.Key)
+	// the purges and invalidations delete the responses in the background, they are not served meanwhile
+	if e != nil && (e.VaryKey != VaryKey(e.Header, req) || h.purgedSince(e, e.Stored)) {
+		e = nil
+	}
+	if e != nil {
+		acceptable := h.acceptable(e, req, opts.Policy, now)
+		if acceptable && now.Before(e.Expires) {
+			writeEntry(w, req, e, "HIT", now)
+			h.served(opts, "HIT")
+			return
+		}
+		staleWhileRevalidate, _ := staleWindows(e, opts)
+		if acceptable && now.Before(e.Expires.Add(staleWhileRevalidate)) {
+			writeEntry(w, req, e, "STALE", now)
+			h.served(opts, "STALE")
+			h.refreshInBackground(req, s, opts, e)
+			return
+		}
+	}
+
+	if !opts.Coalesce {
+		h.forward(w, req, s, opts, e)
+		return
+	}
+	f, leader := h.flights.join(opts.Key)
+	if leader {
+		var stored *entry
+		// the waiters are released even if the origin handler panics, e.g. with http.ErrAbortHandler
+		defer func() { h.flights.land(opts.Key, f, stored) }()
+		stored = h.forward(w, req, s, opts, e)
+		return
+	}
+	timeout := opts.CoalesceTimeout
+	if timeout <= 0 {
+		timeout = DefaultCoalesceTimeout
+	}
+	if shared, ok := f.wait(req.Context(), timeout); ok && shared != nil && shared.VaryKey == VaryKey(shared.Header, req) {
+		writeEntry(w, req, shared, "COALESCED", time.Now())
+		h.served(opts, "COALESCED")
+		return
+	}
+	if req.Context().Err() != nil {
+		// the client is gone
+		return
+	}
+	h.forward(w, req, s, opts, e)
+}
+
+// forward answers req from the origin, and returns the response it cached, or nil. The stale entry e, if any, is
+// revalidated, and served if the origin fails within its stale-if-error window.
+func (h *Handler) forward(w http.ResponseWriter, req *http.Request, s store.Store, opts Options, e *entry) *entry {
+	if e == nil {
+		w.Header().Set(HeaderCacheStatus, "MISS")
+		h.served(opts, "MISS")
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		requestTime := time.Now()
+		h.origin.ServeHTTP(rec, req)
+		responseTime := time.Now()
+		h.originRequested(opts, rec.status, requestTime, responseTime)
+		return h.save(s, req, opts, rec.status, rec.Header(), rec.body.Bytes(), requestTime, responseTime)
+	}
+
+	revalidated, stored, res := h.refresh(req, s, opts, e)
+	now := time.Now()
+	_, staleIfError := staleWindows(e, opts)
+	switch {
+	case revalidated != nil:
+		writeEntry(w, req, revalidated, "REVALIDATED", now)
+		h.served(opts, "REVALIDATED")
+	case res.status >= http.StatusInternalServerError && h.acceptable(e, req, opts.Policy, now) &&
+		now.Before(e.Expires.Add(staleIfError)):
+		h.logf("Serving the stale response %q, the origin answered %d", opts.Key, res.status)
+		writeEntry(w, req, e, "STALE", now)
+		h.served(opts, "STALE")
+	default:
+		res.writeTo(w, "MISS")
+		h.served(opts, "MISS")
+	}
+	return stored
+}
+
+func (h *Handler) acceptable(e *entry, req *http.Request, policy Policy, now time.Time) bool {
+	if policy == PolicyOverride {
+		return true
+	}
+	return Acceptable(req, e.age(now), e.Expires.Sub(now))
+}
+
+// staleWindows returns how long e may be served after it expires while it's refreshed, and when the origin fails.
+// The windows of opts apply unless the origin forbids serving e stale, and with the Respect policy they are extended
+// by the stale-while-revalidate and stale-if-error directives of e, see RFC 5861.
+func staleWindows(e *entry, opts Options) (time.Duration, time.Duration) {
+	staleWhileRevalidate, staleIfError := opts.StaleWhileRevalidate, opts.StaleIfError
+	if opts.Policy == PolicyOverride {
+		return staleWhileRevalidate, staleIfError
+	}
+	directives := ParseCacheControl(e.Header)
+	// s-maxage implies proxy-revalidate for a shared cache, see RFC 9111 section 5.2.2.10
+	if directives.Has("must-revalidate") || directives.Has("proxy-revalidate") || directives.Has("s-maxage") {
+		return 0, 0
+	}
+	if opts.Policy == PolicyRespect {
+		if d, ok := directives.Seconds("stale-while-revalidate"); ok && d > staleWhileRevalidate {
+			staleWhileRevalidate = d
+		}
+		if d, ok := directives.Seconds("stale-if-error"); ok && d > staleIfError {
+			staleIfError = d
+		}
+	}
+	return staleWhileRevalidate, staleIfError
+}
+
+// refreshInBackground refreshes e from the origin after req has been answered, unless it's already being refreshed
+func (h *Handler) refreshInBackground(req *http.Request, s store.Store, opts Options, e *entry) {
+	f, leader := h.flights.join(opts.Key)
+	if !leader {
+		return
+	}
+
+	// the request must outlive the one of the client, which is canceled once answered
+	background := req.WithContext(context.Background())
+	background.Header = cloneHeader(req.Header)
+	background.Body = http.NoBody
+	background.ContentLength = 0
+	go func() {
+		var stored *entry
+		defer func() { h.flights.land(opts.Key, f, stored) }()
+		var res *bufferedResponse
+		if _, stored, res = h.refresh(background, s, opts, e); res != nil && res.status != http.StatusOK {
+			h.logf("Failed to refresh the cached response %q, the origin answered %d", opts.Key, res.status)
+		}
+	}()
+}
+
+// refresh asks the origin for a new response to req, with a conditional request if e has validators, and caches it.
+// It returns e updated if the origin answered 304 Not Modified, otherwise the response of the origin, and the response
+// it cached, if any.
+func (h *Handler) refresh(req *http.Request, s store.Store, opts Options, e *entry) (*entry, *entry, *bufferedResponse) {
+	conditional := req.WithContext(req.Context())
+	conditional.Header = cloneHeader(req.Header)
+	// the validators of the cache replace the ones of the client, which are checked against the cached response
+	for _, k := range []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range"} {
+		conditional.Header.Del(k)
+	}
+	if etag := e.Header.Get("ETag"); etag != "" {
+		conditional.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := e.Header.Get("Last-Modified"); lastModified != "" {
+		conditional.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	res := newBufferedResponse()
+	requestTime := time.Now()
+	h.origin.ServeHTTP(res, conditional)
+	responseTime := time.Now()
+	h.originRequested(opts, res.status, requestTime, responseTime)
+	if e.hasValidators() {
+		h.revalidated(opts, res.status == http.StatusNotModified)
+	}
+
+	if res.status != http.StatusNotModified || !e.hasValidators() {
+		return nil, h.save(s, req, opts, res.status, res.header, res.body.Bytes(), requestTime, responseTime), res
+	}
+
+	revalidated := *e
+	revalidated.Header = cloneHeader(e.Header)
+	// the age of the stored response restarts from the 304
+	revalidated.Header.Del("Age")
+	updateHeader(revalidated.Header, res.header)
+	ttl, storable := TTL(opts.Policy, opts.TTL, req, revalidated.Header, requestTime, responseTime)
+	revalidated.Stored = responseTime
+	revalidated.InitialAge = InitialAge(revalidated.Header, requestTime, responseTime)
+	revalidated.Expires = responseTime.Add(ttl)
+	if !storable || h.purgedSince(&revalidated, requestTime) {
+		if err := s.Delete(opts.Key); err != nil {
+			h.logf("Failed to delete the cached response %q: %v", opts.Key, err)
+		}
+		return &revalidated, nil, nil
+	}
+	h.put(s, opts, &revalidated, ttl)
+	return &revalidated, &revalidated, nil
+}
+
+// save caches the response of the origin to req if it's storable, and returns its cache entry or nil
+func (h *Handler) save(s store.Store, req *http.Request, opts Options, status int, header http.Header, body []byte,
+	requestTime, responseTime time.Time) *entry {
+	if status != http.StatusOK {
+		return nil
+	}
+	ttl, ok := TTL(opts.Policy, opts.TTL, req, header, requestTime, responseTime)
+	if !ok {
+		return nil
+	}
+
+	// with PolicyOverride the response is stored whatever its headers, but not its cookies
+	stored := make(http.Header, len(header))
+	for k, v := range header {
+		if k != HeaderCacheStatus && k != "Set-Cookie" {
+			stored[k] = append([]string(nil), v...)
+		}
+	}
+	e := &entry{
+		Status:     status,
+		Header:     stored,
+		Body:       body,
+		Stored:     responseTime,
+		InitialAge: InitialAge(stored, requestTime, responseTime),
+		Expires:    responseTime.Add(ttl),
+		VaryKey:    VaryKey(stored, req),
+		URL:        requestURL(req),
+		Tags:       tagsOf(stored),
+	}
+	// the response may predate a purge sent while it was requested
+	if h.purgedSince(e, requestTime) {
+		return nil
+	}
+	h.put(s, opts, e, ttl)
+	return e
+}
+
+// requestURL returns the path and the query of req
+func requestURL(req *http.Request) string {
+	if req.URL.RawQuery == "" {
+		return req.URL.Path
+	}
+	return req.URL.Path + "?" + req.URL.RawQuery
+}
+
+// lookup returns the cache entry of key, fresh or not, or nil
+func (h *Handler) lookup(s store.Store, key string) *entry {
+	value, ok, err := s.Get(key)
+	if err != nil {
+		h.logf("Failed to read the cached response %q: %v", key, err)
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	e := &entry{}
+	if err := gob.NewDecoder(bytes.NewReader(value)).Decode(e); err != nil {
+		h.logf("Failed to decode the cached response %q: %v", key, err)
+		return nil
+	}
+	return e
+}
+
+// put saves e in the store for ttl. It's kept longer if it can still be served or revalidated once stale.
+func (h *Handler) put(s store.Store, opts Options, e *entry, ttl time.Duration) {
+	key := opts.Key
+	var retention time.Duration
+	if e.hasValidators() {
+		retention = h.StaleRetention
+		if retention <= 0 {
+			retention = DefaultStaleRetention
+		}
+	}
+	staleWhileRevalidate, staleIfError := staleWindows(e, opts)
+	if staleWhileRevalidate > retention {
+		retention = staleWhileRevalidate
+	}
+	if staleIfError > retention {
+		retention = staleIfError
+	}
+	ttl += retention
+	e.Retained = time.Now().Add(ttl)
+	var value bytes.Buffer
+	if err := gob.NewEncoder(&value).Encode(e); err != nil {
+		h.logf("Failed to encode the response %q: %v", key, err)
+		return
+	}
+	// a response larger than the store is just not cached
+	if err := s.Set(key, value.Bytes(), ttl); err != nil {
+		if err != store.ErrTooLarge {
+			h.logf("Failed to cache the response %q: %v", key, err)
+		}
+		return
+	}
+	h.index(s, key, e)
+}
+
+func (h *Handler) logf(format string, args ...interface{}) {
+	if h.ErrorLog != nil {
+		h.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// writeEntry serves e to req, or 304 Not Modified if the validators of req match it
+func writeEntry(w http.ResponseWriter, req *http.Request, e *entry, cacheStatus string, now time.Time) {
+	if NotModified(req, e.Header) {
+		for _, k := range notModifiedHeaders {
+			if v, ok := e.Header[k]; ok {
+				w.Header()[k] = v
+			}
+		}
+		w.Header().Set("Age", AgeValue(e.age(now)))
+		w.Header().Set(HeaderCacheStatus, cacheStatus)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	for k, v := range e.Header {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Age", AgeValue(e.age(now)))
+	w.Header().Set(HeaderCacheStatus, cacheStatus)
+	w.WriteHeader(e.Status)
+	if req.Method != http.MethodHead {
+		w.Write(e.Body)
+	}
+}
+
+// recorder passes the response through to the client and keeps a copy of it
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// bufferedResponse keeps a response instead of sending it to the client
+type bufferedResponse struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+}
+
+// writeTo sends the response to w
+func (r *bufferedResponse) writeTo(w http.ResponseWriter, cacheStatus string) {
+	for k, v := range r.header {
+		w.Header()[k] = v
+	}
+	w.Header().Set(HeaderCacheStatus, cacheStatus)
+	w.WriteHeader(r.status)
+	w.Write(r.body.Bytes())
+}
+
+func (r *bufferedResponse) Header() http.Header {
+	return r.header
+}
+
+func (r *bufferedResponse) WriteHeader(status int) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	r.status = status
+}
+
+func (r *bufferedResponse) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	return r.body.Write(b)
+}
+
+func cloneHeader(header http.Header) http.Header {
+	clone := make(http.Header, len(header))
+	for k, v := range header {
+		clone[k] = append([]string(nil), v...)
+	}
+	return clone
+}
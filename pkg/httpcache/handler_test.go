@@ -0,0 +1,347 @@
+package httpcache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"service-cache-operator/pkg/store"
+)
+
+// origin is a versioned resource answering the conditional requests with its ETag and Last-Modified
+type origin struct {
+	mu           sync.Mutex
+	status       int
+	cacheControl string
+	etag         string
+	lastModified time.Time
+	body         string
+	requests     []*http.Request
+}
+
+func newOrigin(body string) *origin {
+	return &origin{
+		status:       http.StatusOK,
+		etag:         `"v1"`,
+		lastModified: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		body:         body,
+	}
+}
+
+// update changes the resource
+func (o *origin) update(etag, body string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.etag = etag
+	o.lastModified = o.lastModified.Add(time.Hour)
+	o.body = body
+}
+
+// fail makes the origin answer with status instead of the resource
+func (o *origin) fail(status int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.status = status
+}
+
+// received returns the requests received by the origin
+func (o *origin) received() []*http.Request {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]*http.Request(nil), o.requests...)
+}
+
+func (o *origin) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.requests = append(o.requests, req)
+	if o.status != http.StatusOK {
+		http.Error(w, "origin failure", o.status)
+		return
+	}
+	if o.cacheControl != "" {
+		w.Header().Set("Cache-Control", o.cacheControl)
+	}
+	w.Header().Set("ETag", o.etag)
+	w.Header().Set("Last-Modified", o.lastModified.Format(http.TimeFormat))
+	if NotModified(req, w.Header()) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Write([]byte(o.body))
+}
+
+// serve sends a request with method to target through h, and returns the response
+func serve(h http.Handler, method, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// cachingHandler returns a Handler caching the responses of origin to the GET requests with opts, keyed by their URL
+func cachingHandler(origin http.Handler, opts Options) *Handler {
+	return NewHandler(origin, func(req *http.Request) (Options, bool) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			return Options{}, false
+		}
+		o := opts
+		o.Key = "GET " + req.URL.RequestURI()
+		return o, true
+	}, store.NewMemory(1<<20, 1))
+}
+
+// expire makes the cached response of key stale, as if its TTL had elapsed
+func expire(t *testing.T, h *Handler, key string) {
+	t.Helper()
+	s := h.Store()
+	e := h.lookup(s, key)
+	if e == nil {
+		t.Fatalf("%q is not cached", key)
+	}
+	e.Expires = time.Now().Add(-time.Second)
+	var value bytes.Buffer
+	if err := gob.NewEncoder(&value).Encode(e); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(key, value.Bytes(), 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitFlight waits for the request to the origin for key to land, e.g. a refresh in the background
+func waitFlight(t *testing.T, h *Handler, key string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		h.flights.mu.Lock()
+		_, inFlight := h.flights.flights[key]
+		h.flights.mu.Unlock()
+		if !inFlight {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the request for %q is still in flight", key)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// assertResponse checks the status, the cache status and the body of w
+func assertResponse(t *testing.T, w *httptest.ResponseRecorder, status int, cacheStatus, body string) {
+	t.Helper()
+	res := w.Result()
+	var b bytes.Buffer
+	b.ReadFrom(res.Body)
+	if res.StatusCode != status || res.Header.Get(HeaderCacheStatus) != cacheStatus || b.String() != body {
+		t.Errorf("got %d %s %q, want %d %s %q", res.StatusCode, res.Header.Get(HeaderCacheStatus), b.String(),
+			status, cacheStatus, body)
+	}
+}
+
+func TestRevalidation(t *testing.T) {
+	o := newOrigin("v1")
+	h := cachingHandler(o, Options{TTL: time.Minute, Policy: PolicyStricter})
+
+	assertResponse(t, serve(h, http.MethodGet, "/item", nil), http.StatusOK, "MISS", "v1")
+	assertResponse(t, serve(h, http.MethodGet, "/item", nil), http.StatusOK, "HIT", "v1")
+
+	// the stale response is revalidated with the validators of the cache, and served again
+	expire(t, h, "GET /item")
+	assertResponse(t, serve(h, http.MethodGet, "/item", nil), http.StatusOK, "REVALIDATED", "v1")
+	requests := o.received()
+	if len(requests) != 2 {
+		t.Fatalf("the origin received %d requests, want 2", len(requests))
+	}
+	if got := requests[1].Header.Get("If-None-Match"); got != `"v1"` {
+		t.Errorf("the revalidation has If-None-Match %q, want the ETag of the cached response", got)
+	}
+	if requests[1].Header.Get("If-Modified-Since") == "" {
+		t.Error("the revalidation has no If-Modified-Since")
+	}
+	// the revalidated response is fresh again
+	assertResponse(t, serve(h, http.MethodGet, "/item", nil), http.StatusOK, "HIT", "v1")
+
+	// a changed resource replaces the cached response
+	o.update(`"v2"`, "v2")
+	expire(t, h, "GET /item")
+	assertResponse(t, serve(h, http.MethodGet, "/item", nil), http.StatusOK, "MISS", "v2")
+	assertResponse(t, serve(h, http.MethodGet, "/item", nil), http.StatusOK, "HIT", "v2")
+}
+
+func TestRevalidationIgnoresClientValidators(t *testing.T) {
+	o := newOrigin("v1")
+	h := cachingHandler(o, Options{TTL: time.Minute, Policy: PolicyStricter})
+	serve(h, http.MethodGet, "/item", nil)
+	expire(t, h, "GET /item")
+
+	// the validators of the client don't match the cached response, the cache asks with its own
+	w := serve(h, http.MethodGet, "/item", headerOf("If-None-Match", `"v0"`))
+	assertResponse(t, w, http.StatusOK, "REVALIDATED", "v1")
+	requests := o.received()
+	if got := requests[len(requests)-1].Header.Get("If-None-Match"); got != `"v1"` {
+		t.Errorf("the revalidation has If-None-Match %q, want the ETag of the cached response", got)
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	o := newOrigin("v1")
+	h := cachingHandler(o, Options{TTL: time.Minute, Policy: PolicyStricter})
+	serve(h, http.MethodGet, "/item", nil)
+	lastModified := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+		body   string
+	}{
+		{"if-none-match", headerOf("If-None-Match", `"v1"`), http.StatusNotModified, ""},
+		{"weak if-none-match", headerOf("If-None-Match", `"v0", W/"v1"`), http.StatusNotModified, ""},
+		{"if-none-match star", headerOf("If-None-Match", "*"), http.StatusNotModified, ""},
+		{"other etag", headerOf("If-None-Match", `"v0"`), http.StatusOK, "v1"},
+		{"if-modified-since", headerOf("If-Modified-Since", lastModified.Format(http.TimeFormat)), http.StatusNotModified, ""},
+		{"modified since", headerOf("If-Modified-Since", lastModified.Add(-time.Hour).Format(http.TimeFormat)), http.StatusOK, "v1"},
+		{"if-none-match takes precedence", headerOf("If-None-Match", `"v0"`,
+			"If-Modified-Since", lastModified.Format(http.TimeFormat)), http.StatusOK, "v1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := serve(h, http.MethodGet, "/item", test.header)
+			assertResponse(t, w, test.status, "HIT", test.body)
+			if test.status == http.StatusNotModified && w.Header().Get("ETag") != `"v1"` {
+				t.Errorf("the 304 has ETag %q, want the one of the cached response", w.Header().Get("ETag"))
+			}
+		})
+	}
+	if requests := o.received(); len(requests) != 1 {
+		t.Errorf("the origin received %d requests, want 1", len(requests))
+	}
+}
+
+func TestSetCookie(t *testing.T) {
+	cookieOrigin := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: req.URL.Query().Get("user")})
+		w.Write([]byte("page"))
+	})
+	tests := []struct {
+		policy      Policy
+		cacheStatus string
+	}{
+		{PolicyRespect, "MISS"},
+		{PolicyStricter, "MISS"},
+		{PolicyOverride, "HIT"},
+	}
+	for _, test := range tests {
+		t.Run(string(test.policy), func(t *testing.T) {
+			h := NewHandler(cookieOrigin, func(req *http.Request) (Options, bool) {
+				return Options{Key: "GET /page", TTL: time.Minute, Policy: test.policy}, true
+			}, store.NewMemory(1<<20, 1))
+			serve(h, http.MethodGet, "/page?user=alice", nil)
+			w := serve(h, http.MethodGet, "/page?user=bob", nil)
+			assertResponse(t, w, http.StatusOK, test.cacheStatus, "page")
+			// the cookie of alice is never handed to bob
+			if cookie := w.Header().Get("Set-Cookie"); cookie != "" && cookie != "session=bob" {
+				t.Errorf("Set-Cookie = %q, want the one of the second request or none", cookie)
+			}
+		})
+	}
+}
+
+func TestUpdateHeader(t *testing.T) {
+	stored := headerOf("Cache-Control", "max-age=60", "Content-Length", "2", "X-Old", "kept")
+	updateHeader(stored, headerOf("Cache-Control", "max-age=120", "Content-Length", "0", HeaderCacheStatus, "MISS", "Set-Cookie", "a=b"))
+	if got := stored.Get("Cache-Control"); got != "max-age=120" {
+		t.Errorf("Cache-Control = %q, want the one of the 304", got)
+	}
+	if got := stored.Get("Content-Length"); got != "2" {
+		t.Errorf("Content-Length = %q, want the one of the stored response", got)
+	}
+	if stored.Get("X-Old") != "kept" || stored.Get(HeaderCacheStatus) != "" || stored.Get("Set-Cookie") != "" {
+		t.Errorf("unexpected header after the update: %v", stored)
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         Options
+		cacheControl string
+		stale        bool
+	}{
+		{"configured", Options{TTL: time.Minute, Policy: PolicyStricter, StaleWhileRevalidate: time.Minute}, "", true},
+		{"not configured", Options{TTL: time.Minute, Policy: PolicyStricter}, "", false},
+		{"directive with respect", Options{TTL: time.Minute, Policy: PolicyRespect}, "max-age=60, stale-while-revalidate=60", true},
+		{"directive with stricter", Options{TTL: time.Minute, Policy: PolicyStricter}, "max-age=60, stale-while-revalidate=60", false},
+		{"must-revalidate", Options{TTL: time.Minute, Policy: PolicyStricter, StaleWhileRevalidate: time.Minute},
+			"max-age=60, must-revalidate", false},
+		{"override ignores must-revalidate", Options{TTL: time.Minute, Policy: PolicyOverride, StaleWhileRevalidate: time.Minute},
+			"max-age=60, must-revalidate", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o := newOrigin("v1")
+			o.cacheControl = test.cacheControl
+			h := cachingHandler(o, test.opts)
+			serve(h, http.MethodGet, "/item", nil)
+			o.update(`"v2"`, "v2")
+			expire(t, h, "GET /item")
+
+			if !test.stale {
+				// the client waits for the new response
+				assertResponse(t, serve(h, http.MethodGet, "/item", nil), http.StatusOK, "MISS", "v2")
+				return
+			}
+			// the stale response is served right away, and refreshed in the background
+			assertResponse(t, serve(h, http.MethodGet, "/item", nil), http.StatusOK, "STALE", "v1")
+			waitFlight(t, h, "GET /item")
+			assertResponse(t, serve(h, http.MethodGet, "/item", nil), http.StatusOK, "HIT", "v2")
+			if requests := o.received(); len(requests) != 2 {
+				t.Errorf("the origin received %d requests, want 2", len(requests))
+			}
+		})
+	}
+}
+
+func TestStaleIfError(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         Options
+		cacheControl string
+		failure      int
+		stale        bool
+	}{
+		{"configured", Options{TTL: time.Minute, Policy: PolicyStricter, StaleIfError: time.Minute}, "", http.StatusBadGateway, true},
+		{"not configured", Options{TTL: time.Minute, Policy: PolicyStricter}, "", http.StatusBadGateway, false},
+		{"client error", Options{TTL: time.Minute, Policy: PolicyStricter, StaleIfError: time.Minute}, "", http.StatusNotFound, false},
+		{"directive with respect", Options{TTL: time.Minute, Policy: PolicyRespect}, "max-age=60, stale-if-error=60",
+			http.StatusServiceUnavailable, true},
+		{"must-revalidate", Options{TTL: time.Minute, Policy: PolicyStricter, StaleIfError: time.Minute},
+			"max-age=60, must-revalidate", http.StatusBadGateway, false},
+		{"s-maxage", Options{TTL: time.Minute, Policy: PolicyStricter, StaleIfError: time.Minute},
+			"s-maxage=60", http.StatusBadGateway, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o := newOrigin("v1")
+			o.cacheControl = test.cacheControl
+			h := cachingHandler(o, test.opts)
+			serve(h, http.MethodGet, "/item", nil)
+			o.fail(test.failure)
+			expire(t, h, "GET /item")
+
+			if test.stale {
+				assertResponse(t, serve(h, http.MethodGet, "/item", nil), http.StatusOK, "STALE", "v1")
+			} else {
+				assertResponse(t, serve(h, http.MethodGet, "/item", nil), test.failure, "MISS", "origin failure\n")
+			}
+		})
+	}
+}
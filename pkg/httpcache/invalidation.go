@@ -0,0 +1,250 @@
+package httpcache
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"service-cache-operator/pkg/store"
+)
+
+// IsSafeMethod returns true if method doesn't change the state of the origin, see RFC 9110 section 9.2.1.
+// The other methods invalidate the cached responses with Options.Invalidate.
+func IsSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// invalidatingWriter invalidates the cached responses of a request before sending its successful response, so that
+// the client doesn't get them back right after
+type invalidatingWriter struct {
+	http.ResponseWriter
+	h           *Handler
+	req         *http.Request
+	opts        Options
+	wroteHeader bool
+}
+
+func (w *invalidatingWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	// only a success changes the state of the origin, see RFC 9111 section 4.4
+	if status >= 200 && status < 400 {
+		paths := []string{w.req.URL.Path}
+		if w.opts.InvalidateLocations {
+			paths = append(paths, locationPaths(w.req, w.Header())...)
+		}
+		w.h.invalidate(paths)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *invalidatingWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// invalidation is the last invalidation of a path
+type invalidation struct {
+	at time.Time
+	// deleted is true once the cached responses of the path are deleted from the store, until then they are not served
+	deleted bool
+}
+
+// invalidate stops serving the cached responses of paths, whatever their method, query and variant, and deletes them in
+// the background, so that the request doesn't wait for the store. The invalidations of a path are coalesced until its
+// responses are deleted.
+func (h *Handler) invalidate(paths []string) {
+	now := time.Now()
+	h.invalidationsMu.Lock()
+	defer h.invalidationsMu.Unlock()
+	if h.invalidated == nil {
+		h.invalidated = map[string]*invalidation{}
+		h.pending = map[string]bool{}
+	}
+	// forget the deleted invalidations older than the window from time to time, unless a store is being indexed: its
+	// invalidated responses must still be recognized
+	if now.Sub(h.pruned) > purgeWindow && h.indexing == 0 {
+		for path, inv := range h.invalidated {
+			if inv.deleted && now.Sub(inv.at) > purgeWindow {
+				delete(h.invalidated, path)
+			}
+		}
+		h.pruned = now
+	}
+	for _, path := range paths {
+		h.invalidated[path] = &invalidation{at: now}
+		h.pending[path] = true
+	}
+	if !h.invalidating {
+		h.invalidating = true
+		go h.runInvalidations()
+	}
+}
+
+// invalidatedSince returns true if the path of e has been invalidated after since. h.invalidationsMu must be held.
+func (h *Handler) invalidatedSince(e *entry, since time.Time) bool {
+	inv, ok := h.invalidated[e.path()]
+	return ok && inv.at.After(since)
+}
+
+// runInvalidations deletes the cached responses of the pending invalidations until there are none left. The
+// invalidations received while the responses are deleted are batched in the next round.
+func (h *Handler) runInvalidations() {
+	for {
+		h.invalidationsMu.Lock()
+		if len(h.pending) == 0 {
+			h.invalidating = false
+			h.invalidationsMu.Unlock()
+			return
+		}
+		started := time.Now()
+		var paths, keys []string
+		for path := range h.pending {
+			paths = append(paths, path)
+			keys = append(keys, h.paths.take(path)...)
+		}
+		h.pending = map[string]bool{}
+		h.invalidationsMu.Unlock()
+
+		s := h.Store()
+		for _, key := range keys {
+			if err := s.Delete(key); err != nil {
+				h.logf("Failed to invalidate the cached response %q: %v", key, err)
+			}
+		}
+
+		h.invalidationsMu.Lock()
+		for _, path := range paths {
+			// a path invalidated again meanwhile is pending
+			if inv := h.invalidated[path]; inv != nil && !inv.at.After(started) {
+				inv.deleted = true
+			}
+		}
+		h.invalidationsMu.Unlock()
+	}
+}
+
+// index records key as the one of e in the store s for the invalidations of its path, or deletes it if the path has
+// been invalidated since e was received, e.g. while it was stored
+func (h *Handler) index(s store.Store, key string, e *entry) {
+	h.invalidationsMu.Lock()
+	invalidated := h.invalidatedSince(e, e.Stored)
+	if !invalidated {
+		h.paths.add(e.path(), key, e.Retained)
+	}
+	h.invalidationsMu.Unlock()
+	if invalidated {
+		if err := s.Delete(key); err != nil {
+			h.logf("Failed to invalidate the cached response %q: %v", key, err)
+		}
+	}
+}
+
+// indexStore indexes the responses already cached in s, e.g. by a previous process in a persistent store, so that
+// their invalidations find them
+func (h *Handler) indexStore(s store.Store) {
+	h.invalidationsMu.Lock()
+	h.indexing++
+	h.invalidationsMu.Unlock()
+	defer func() {
+		h.invalidationsMu.Lock()
+		h.indexing--
+		h.invalidationsMu.Unlock()
+	}()
+
+	err := s.Keys(func(key string) error {
+		if e := h.lookup(s, key); e != nil {
+			h.index(s, key, e)
+		}
+		return nil
+	})
+	if err != nil {
+		h.logf("Failed to index the cached responses: %v", err)
+	}
+}
+
+// pathIndex lists the keys of the cached responses by the path of their request, so that the invalidations don't scan
+// the store. The keys are remembered until the store drops them, even if it evicts them earlier.
+type pathIndex struct {
+	mu sync.Mutex
+	// keys are the keys of each path, with when the store drops them, zero if never
+	keys  map[string]map[string]time.Time
+	swept time.Time
+}
+
+// add records that the response cached under key is one of path, until retained
+func (x *pathIndex) add(path, key string, retained time.Time) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	now := time.Now()
+	if x.keys == nil {
+		x.keys = map[string]map[string]time.Time{}
+		x.swept = now
+	}
+	// forget the keys dropped by the store from time to time
+	if now.Sub(x.swept) > purgeWindow {
+		for p, keys := range x.keys {
+			for k, until := range keys {
+				if !until.IsZero() && now.After(until) {
+					delete(keys, k)
+				}
+			}
+			if len(keys) == 0 {
+				delete(x.keys, p)
+			}
+		}
+		x.swept = now
+	}
+	keys := x.keys[path]
+	if keys == nil {
+		keys = map[string]time.Time{}
+		x.keys[path] = keys
+	}
+	keys[key] = retained
+}
+
+// take forgets the keys of path, and returns them
+func (x *pathIndex) take(path string) []string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	var keys []string
+	for key := range x.keys[path] {
+		keys = append(keys, key)
+	}
+	delete(x.keys, path)
+	return keys
+}
+
+// reset forgets all the keys, when the store is replaced
+func (x *pathIndex) reset() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.keys = nil
+}
+
+// locationPaths returns the paths of the Location and Content-Location headers of the response to req which are on
+// the host of req. The other hosts may be other origins, see RFC 9111 section 4.4.
+func locationPaths(req *http.Request, header http.Header) []string {
+	var paths []string
+	for _, name := range []string{"Location", "Content-Location"} {
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+		u, err := req.URL.Parse(value)
+		if err != nil || u.Host != "" && !strings.EqualFold(u.Host, req.Host) {
+			continue
+		}
+		paths = append(paths, u.Path)
+	}
+	return paths
+}
@@ -0,0 +1,163 @@
+package httpcache
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"service-cache-operator/pkg/store"
+)
+
+// invalidatingHandler returns a Handler caching the GET responses of origin for a minute, and invalidating them on
+// the other methods
+func invalidatingHandler(origin http.Handler) *Handler {
+	return NewHandler(origin, func(req *http.Request) (Options, bool) {
+		if !IsSafeMethod(req.Method) {
+			return Options{Invalidate: true, InvalidateLocations: true}, true
+		}
+		return Options{Key: req.Method + " " + req.URL.RequestURI(), TTL: time.Minute, Policy: PolicyOverride}, true
+	}, store.NewMemory(1<<20, 1))
+}
+
+// countingOrigin answers the GET requests with the number of requests it received, and the other requests with status
+// and location
+func countingOrigin(status int, location string) http.Handler {
+	requests := 0
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.Method != http.MethodGet {
+			if location != "" {
+				w.Header().Set("Location", location)
+			}
+			w.WriteHeader(status)
+			return
+		}
+		fmt.Fprint(w, requests)
+	})
+}
+
+// waitInvalidations waits for the background invalidations of h to be done
+func waitInvalidations(t *testing.T, h *Handler) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		h.invalidationsMu.Lock()
+		invalidating := h.invalidating
+		h.invalidationsMu.Unlock()
+		if !invalidating {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the invalidations are still running")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestInvalidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		location    string
+		target      string
+		invalidated []string
+		kept        []string
+	}{
+		{"success", http.StatusNoContent, "", "/items/1", []string{"/items/1", "/items/1?lang=en"}, []string{"/items/2"}},
+		{"error", http.StatusInternalServerError, "", "/items/1", nil, []string{"/items/1", "/items/2"}},
+		{"location", http.StatusCreated, "/items/2", "/items", []string{"/items", "/items/2"}, []string{"/items/1"}},
+		{"other host", http.StatusCreated, "http://other.example.com/items/2", "/items", []string{"/items"}, []string{"/items/2"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := invalidatingHandler(countingOrigin(test.status, test.location))
+			targets := append(append([]string(nil), test.invalidated...), test.kept...)
+			for _, target := range targets {
+				serve(h, http.MethodGet, target, nil)
+				if w := serve(h, http.MethodGet, target, nil); w.Header().Get(HeaderCacheStatus) != "HIT" {
+					t.Fatalf("GET %s is not cached: %s", target, w.Header().Get(HeaderCacheStatus))
+				}
+			}
+
+			serve(h, http.MethodPost, test.target, nil)
+			// the invalidated responses are not served while they are deleted in the background
+			for _, target := range test.invalidated {
+				if w := serve(h, http.MethodGet, target, nil); w.Header().Get(HeaderCacheStatus) != "MISS" {
+					t.Errorf("GET %s after the invalidation: got %s, want MISS", target, w.Header().Get(HeaderCacheStatus))
+				}
+			}
+			for _, target := range test.kept {
+				if w := serve(h, http.MethodGet, target, nil); w.Header().Get(HeaderCacheStatus) != "HIT" {
+					t.Errorf("GET %s after the invalidation: got %s, want HIT", target, w.Header().Get(HeaderCacheStatus))
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidationDeletesInBackground(t *testing.T) {
+	h := invalidatingHandler(countingOrigin(http.StatusNoContent, ""))
+	serve(h, http.MethodGet, "/items/1", nil)
+	serve(h, http.MethodGet, "/items/2", nil)
+
+	serve(h, http.MethodDelete, "/items/1", nil)
+	waitInvalidations(t, h)
+	if _, ok, _ := h.Store().Get("GET /items/1"); ok {
+		t.Error("the invalidated response is still in the store")
+	}
+	if _, ok, _ := h.Store().Get("GET /items/2"); !ok {
+		t.Error("the response of another path has been deleted")
+	}
+
+	// the response cached after the invalidation is served
+	serve(h, http.MethodGet, "/items/1", nil)
+	if w := serve(h, http.MethodGet, "/items/1", nil); w.Header().Get(HeaderCacheStatus) != "HIT" {
+		t.Errorf("GET /items/1 cached after the invalidation: got %s, want HIT", w.Header().Get(HeaderCacheStatus))
+	}
+}
+
+func TestInvalidationCoalesced(t *testing.T) {
+	h := invalidatingHandler(countingOrigin(http.StatusNoContent, ""))
+	for i := 0; i < 10; i++ {
+		serve(h, http.MethodPost, "/items", nil)
+		serve(h, http.MethodDelete, fmt.Sprintf("/items/%d", i%2), nil)
+	}
+	waitInvalidations(t, h)
+	h.invalidationsMu.Lock()
+	defer h.invalidationsMu.Unlock()
+	if len(h.invalidated) != 3 {
+		t.Errorf("%d invalidations are remembered, want one per path", len(h.invalidated))
+	}
+}
+
+func TestInvalidationOfPreviousProcess(t *testing.T) {
+	s := store.NewMemory(1<<20, 1)
+	previous := invalidatingHandler(countingOrigin(http.StatusNoContent, ""))
+	previous.SetStore(s)
+	serve(previous, http.MethodGet, "/items/1", nil)
+	serve(previous, http.MethodGet, "/items/1?lang=en", nil)
+
+	// a new process finds the responses cached in the store
+	h := invalidatingHandler(countingOrigin(http.StatusNoContent, ""))
+	h.SetStore(s)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		h.invalidationsMu.Lock()
+		indexing := h.indexing
+		h.invalidationsMu.Unlock()
+		if indexing == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the store is still indexed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	serve(h, http.MethodDelete, "/items/1", nil)
+	waitInvalidations(t, h)
+	for _, key := range []string{"GET /items/1", "GET /items/1?lang=en"} {
+		if _, ok, _ := s.Get(key); ok {
+			t.Errorf("the invalidated response %q is still in the store", key)
+		}
+	}
+}
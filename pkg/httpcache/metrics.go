@@ -0,0 +1,37 @@
+package httpcache
+
+import (
+	"time"
+)
+
+// Metrics receives the events of a Handler, e.g. to export them to Prometheus. Its methods are called while serving
+// the requests, they must be fast and safe for concurrent use.
+type Metrics interface {
+	// Served is called for each response to a cacheable request, with its cache status: HIT, MISS, STALE,
+	// REVALIDATED or COALESCED
+	Served(opts Options, cacheStatus string)
+	// OriginRequested is called after each request of a cacheable response to the origin, with the status and the
+	// duration of its response
+	OriginRequested(opts Options, status int, duration time.Duration)
+	// Revalidated is called after each conditional request to the origin, notModified tells whether the cached
+	// response is still valid
+	Revalidated(opts Options, notModified bool)
+}
+
+func (h *Handler) served(opts Options, cacheStatus string) {
+	if h.Metrics != nil {
+		h.Metrics.Served(opts, cacheStatus)
+	}
+}
+
+func (h *Handler) originRequested(opts Options, status int, requestTime, responseTime time.Time) {
+	if h.Metrics != nil {
+		h.Metrics.OriginRequested(opts, status, responseTime.Sub(requestTime))
+	}
+}
+
+func (h *Handler) revalidated(opts Options, notModified bool) {
+	if h.Metrics != nil {
+		h.Metrics.Revalidated(opts, notModified)
+	}
+}
@@ -0,0 +1,216 @@
+package httpcache
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// HeaderSurrogateKey is the response header listing the tags of a response, separated by spaces. The cached responses
+// are purged by tag.
+const HeaderSurrogateKey = "Surrogate-Key"
+
+// purgeWindow is how long a purge is remembered once its responses are deleted, so that the responses requested before
+// it and received after it are not cached. It's longer than the time the origin takes to answer.
+const purgeWindow = time.Minute
+
+// Purge describes the cached responses to delete. A response is deleted if it matches any of the fields.
+type Purge struct {
+	// All deletes all the responses
+	All bool `json:"all,omitempty"`
+	// Keys delete the responses to the requests with these targets, path and query, e.g. "/items/42?lang=en",
+	// whatever their method and the other parts of their cache key
+	Keys []string `json:"keys,omitempty"`
+	// PathPrefixes delete the responses to the requests whose path starts with one of them
+	PathPrefixes []string `json:"pathPrefixes,omitempty"`
+	// PathRegexes delete the responses to the requests whose path matches one of these regular expressions
+	PathRegexes []string `json:"pathRegexes,omitempty"`
+	// Tags delete the responses with one of these tags in their Surrogate-Key header
+	Tags []string `json:"tags,omitempty"`
+}
+
+// PurgeResult is the outcome of a purge
+type PurgeResult struct {
+	// Purged is the number of deleted responses
+	Purged int `json:"purged"`
+}
+
+// compiledPurge is a Purge ready to match cache entries
+type compiledPurge struct {
+	Purge
+	regexps []*regexp.Regexp
+	// at is when the purge happened
+	at time.Time
+	// done is true once the matching responses are deleted from the store, until then they are not served.
+	// It's guarded by Handler.purgesMu.
+	done bool
+}
+
+func compilePurge(p Purge) (*compiledPurge, error) {
+	compiled := &compiledPurge{Purge: p, at: time.Now()}
+	for _, expr := range p.PathRegexes {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		compiled.regexps = append(compiled.regexps, re)
+	}
+	return compiled, nil
+}
+
+// matches returns true if e must be deleted by the purge
+func (p *compiledPurge) matches(e *entry) bool {
+	if p.All {
+		return true
+	}
+	path := e.path()
+	for _, key := range p.Keys {
+		if e.URL == key {
+			return true
+		}
+	}
+	for _, prefix := range p.PathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	for _, re := range p.regexps {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	for _, tag := range p.Tags {
+		for _, t := range e.Tags {
+			if t == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Purge deletes the cached responses described by p, and returns how many were deleted
+func (h *Handler) Purge(p Purge) (PurgeResult, error) {
+	compiled, err := compilePurge(p)
+	if err != nil {
+		return PurgeResult{}, err
+	}
+	h.addPurges(compiled)
+	defer h.purgesDone(compiled)
+	return h.deleteMatching(compiled, nil)
+}
+
+// addPurges remembers purges, whose responses are not served or cached anymore
+func (h *Handler) addPurges(purges ...*compiledPurge) {
+	h.purgesMu.Lock()
+	defer h.purgesMu.Unlock()
+	h.purges = append(h.purges, purges...)
+}
+
+// purgesDone records that the responses of purges are deleted from the store
+func (h *Handler) purgesDone(purges ...*compiledPurge) {
+	h.purgesMu.Lock()
+	defer h.purgesMu.Unlock()
+	for _, p := range purges {
+		p.done = true
+	}
+}
+
+// deleteMatching deletes the cached responses matched by p. Only the entries whose key is accepted by filter are read,
+// all of them if it's nil.
+func (h *Handler) deleteMatching(p *compiledPurge, filter func(key string) bool) (PurgeResult, error) {
+	result := PurgeResult{}
+	s := h.Store()
+	err := s.Keys(func(key string) error {
+		if filter != nil && !filter(key) {
+			return nil
+		}
+		e := h.lookup(s, key)
+		if e == nil || !p.matches(e) {
+			return nil
+		}
+		if err := s.Delete(key); err != nil {
+			return err
+		}
+		result.Purged++
+		return nil
+	})
+	return result, err
+}
+
+// purgedSince returns true if e has been purged or invalidated after since, when it was requested from the origin or
+// stored
+func (h *Handler) purgedSince(e *entry, since time.Time) bool {
+	h.invalidationsMu.RLock()
+	invalidated := h.invalidatedSince(e, since)
+	h.invalidationsMu.RUnlock()
+	if invalidated {
+		return true
+	}
+
+	h.purgesMu.Lock()
+	defer h.purgesMu.Unlock()
+	// forget the deleted purges older than the window, they are in order
+	i := 0
+	for i < len(h.purges) && h.purges[i].done && time.Since(h.purges[i].at) > purgeWindow {
+		i++
+	}
+	h.purges = h.purges[i:]
+	for _, p := range h.purges {
+		if p.at.After(since) && p.matches(e) {
+			return true
+		}
+	}
+	return false
+}
+
+// tagsOf returns the tags listed in the Surrogate-Key headers
+func tagsOf(header http.Header) []string {
+	var tags []string
+	for _, value := range header[HeaderSurrogateKey] {
+		tags = append(tags, strings.Fields(value)...)
+	}
+	return tags
+}
+
+// NewPurgeHandler returns the HTTP endpoint purging the responses cached by h. It accepts POST requests with a JSON
+// Purge body, authenticated with the "Authorization: Bearer <token>" header, and answers with a JSON PurgeResult.
+// Every request is rejected if token is empty.
+func NewPurgeHandler(h *Handler, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		auth := req.Header.Get("Authorization")
+		if token == "" || !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		p := Purge{}
+		err := json.NewDecoder(req.Body).Decode(&p)
+		if err == nil {
+			// the regular expressions are checked first, so that a failure of the store isn't a client error
+			_, err = compilePurge(p)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid purge: %v", err), http.StatusBadRequest)
+			return
+		}
+		result, err := h.Purge(p)
+		if err != nil {
+			h.logf("Failed to purge the cached responses: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+}
@@ -0,0 +1,166 @@
+package httpcache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// taggedPaths are the responses cached by purgingHandler, with their Surrogate-Key
+var taggedPaths = map[string]string{
+	"/items/1":         "items item-1",
+	"/items/2?lang=en": "items item-2",
+	"/users/1":         "user-1",
+}
+
+// purgingHandler returns a Handler with the responses of taggedPaths cached
+func purgingHandler(t *testing.T) *Handler {
+	t.Helper()
+	origin := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set(HeaderSurrogateKey, taggedPaths[req.URL.RequestURI()])
+		w.Write([]byte(req.URL.RequestURI()))
+	})
+	h := cachingHandler(origin, Options{TTL: time.Minute, Policy: PolicyStricter})
+	for target := range taggedPaths {
+		assertResponse(t, serve(h, http.MethodGet, target, nil), http.StatusOK, "MISS", target)
+	}
+	return h
+}
+
+// cachedTargets returns the sorted targets of the responses cached by h
+func cachedTargets(t *testing.T, h *Handler) []string {
+	t.Helper()
+	var targets []string
+	for target := range taggedPaths {
+		if h.lookup(h.Store(), "GET "+target) != nil {
+			targets = append(targets, target)
+		}
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+func TestPurge(t *testing.T) {
+	tests := []struct {
+		name  string
+		purge Purge
+		want  []string
+	}{
+		{"nothing", Purge{}, []string{"/items/1", "/items/2?lang=en", "/users/1"}},
+		{"all", Purge{All: true}, nil},
+		{"keys", Purge{Keys: []string{"/items/2?lang=en", "/items/2"}}, []string{"/items/1", "/users/1"}},
+		{"key without query", Purge{Keys: []string{"/items/2"}}, []string{"/items/1", "/items/2?lang=en", "/users/1"}},
+		{"prefixes", Purge{PathPrefixes: []string{"/items/"}}, []string{"/users/1"}},
+		{"regexes", Purge{PathRegexes: []string{`^/(items|users)/1$`}}, []string{"/items/2?lang=en"}},
+		{"tags", Purge{Tags: []string{"item-2", "user-1"}}, []string{"/items/1"}},
+		{"any field", Purge{Keys: []string{"/users/1"}, Tags: []string{"item-1"}}, []string{"/items/2?lang=en"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := purgingHandler(t)
+			result, err := h.Purge(test.purge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := cachedTargets(t, h)
+			if strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("cached responses after the purge = %q, want %q", got, test.want)
+			}
+			if want := len(taggedPaths) - len(test.want); result.Purged != want {
+				t.Errorf("Purged = %d, want %d", result.Purged, want)
+			}
+		})
+	}
+}
+
+func TestPurgeInvalidRegex(t *testing.T) {
+	h := purgingHandler(t)
+	if _, err := h.Purge(Purge{PathRegexes: []string{"("}}); err == nil {
+		t.Error("an invalid regular expression is accepted")
+	}
+	if got := cachedTargets(t, h); len(got) != len(taggedPaths) {
+		t.Errorf("the invalid purge deleted responses, %q are left", got)
+	}
+}
+
+func TestPurgeNotCachedAfterward(t *testing.T) {
+	o := newBlockingOrigin("")
+	h := cachingHandler(o, Options{TTL: time.Minute, Policy: PolicyStricter})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serve(h, http.MethodGet, "/item", nil)
+	}()
+	<-o.started
+	// the response requested before the purge is received after it
+	if _, err := h.Purge(Purge{All: true}); err != nil {
+		t.Fatal(err)
+	}
+	close(o.release)
+	<-done
+	if h.lookup(h.Store(), "GET /item") != nil {
+		t.Error("the response requested before the purge is cached")
+	}
+}
+
+func TestPurgeHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		auth   string
+		body   string
+		status int
+		want   []string
+	}{
+		{"purged", "secret", http.MethodPost, "Bearer secret", `{"tags": ["items"]}`, http.StatusOK, []string{"/users/1"}},
+		{"wrong method", "secret", http.MethodGet, "Bearer secret", "", http.StatusMethodNotAllowed, nil},
+		{"no token configured", "", http.MethodPost, "Bearer ", `{"all": true}`, http.StatusUnauthorized, nil},
+		{"no authorization", "secret", http.MethodPost, "", `{"all": true}`, http.StatusUnauthorized, nil},
+		{"wrong token", "secret", http.MethodPost, "Bearer other", `{"all": true}`, http.StatusUnauthorized, nil},
+		{"wrong scheme", "secret", http.MethodPost, "Basic secret", `{"all": true}`, http.StatusUnauthorized, nil},
+		{"invalid body", "secret", http.MethodPost, "Bearer secret", `{"all": `, http.StatusBadRequest, nil},
+		{"invalid regex", "secret", http.MethodPost, "Bearer secret", `{"pathRegexes": ["("]}`, http.StatusBadRequest, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := purgingHandler(t)
+			req := httptest.NewRequest(test.method, "/purge", strings.NewReader(test.body))
+			if test.auth != "" {
+				req.Header.Set("Authorization", test.auth)
+			}
+			w := httptest.NewRecorder()
+			NewPurgeHandler(h, test.token).ServeHTTP(w, req)
+
+			if w.Code != test.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, test.status, w.Body.String())
+			}
+			want := test.want
+			if test.status != http.StatusOK {
+				// nothing is purged
+				want = []string{"/items/1", "/items/2?lang=en", "/users/1"}
+			}
+			if got := cachedTargets(t, h); strings.Join(got, " ") != strings.Join(want, " ") {
+				t.Errorf("cached responses after the request = %q, want %q", got, want)
+			}
+			switch test.status {
+			case http.StatusOK:
+				result := PurgeResult{}
+				if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+					t.Fatal(err)
+				}
+				if result.Purged != len(taggedPaths)-len(test.want) {
+					t.Errorf("Purged = %d, want %d", result.Purged, len(taggedPaths)-len(test.want))
+				}
+			case http.StatusMethodNotAllowed:
+				if allow := w.Header().Get("Allow"); allow != http.MethodPost {
+					t.Errorf("Allow = %q, want POST", allow)
+				}
+			}
+		})
+	}
+}
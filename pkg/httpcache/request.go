@@ -0,0 +1,56 @@
+package httpcache
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Acceptable returns true if a cached response may be served to req according to the caching headers of the client,
+// see RFC 9111 section 5.2.1. age is the current age of the response and remaining how long it's still fresh.
+func Acceptable(req *http.Request, age, remaining time.Duration) bool {
+	directives := ParseCacheControl(req.Header)
+	if directives.Has("no-cache") || hasPragmaNoCache(req.Header) {
+		return false
+	}
+	if maxAge, ok := directives.Seconds("max-age"); ok && age > maxAge {
+		return false
+	}
+	if minFresh, ok := directives.Seconds("min-fresh"); ok && remaining < minFresh {
+		return false
+	}
+	return true
+}
+
+// VaryKey returns the values of the request headers of req listed in the Vary header of a response with header.
+// A stored response is only served to the requests with the same VaryKey as the request it answered, see
+// RFC 9111 section 4.1.
+func VaryKey(header http.Header, req *http.Request) string {
+	var names []string
+	for _, value := range header["Vary"] {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strings.Join(req.Header[name], ","))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// AgeValue returns the value of the Age header of a response of age, see RFC 9111 section 5.1
+func AgeValue(age time.Duration) string {
+	if age < 0 {
+		age = 0
+	}
+	return strconv.FormatInt(int64(age/time.Second), 10)
+}
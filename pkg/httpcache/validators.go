@@ -0,0 +1,73 @@
+package httpcache
+
+import (
+	"net/http"
+	"strings"
+)
+
+// notModifiedHeaders are the headers of a stored response sent with a 304 Not Modified, see RFC 9110 section 15.4.5.
+// They are in the canonical form of the keys of http.Header.
+var notModifiedHeaders = []string{"Cache-Control", "Content-Location", "Date", "Etag", "Expires", "Last-Modified", "Vary"}
+
+// skippedUpdateHeaders are the headers of a 304 Not Modified which don't replace the ones of the stored response,
+// see RFC 9111 section 3.2, and the cookies which are never stored
+var skippedUpdateHeaders = map[string]bool{
+	"Content-Length":    true,
+	"Content-Encoding":  true,
+	"Content-Range":     true,
+	"Connection":        true,
+	"Keep-Alive":        true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+	"Trailer":           true,
+	HeaderCacheStatus:   true,
+	"Set-Cookie":        true,
+}
+
+// NotModified returns true if the conditional request req is answered with 304 Not Modified by a response with header,
+// see RFC 9110 section 13.2.2. If-None-Match takes precedence over If-Modified-Since, which only applies to GET and
+// HEAD requests.
+func NotModified(req *http.Request, header http.Header) bool {
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return matchesETag(ifNoneMatch, header.Get("ETag"))
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	ifModifiedSince, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.After(ifModifiedSince)
+}
+
+// matchesETag returns true if etag is one of the entity tags of an If-None-Match header, with the weak comparison
+func matchesETag(ifNoneMatch, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || weakETag(candidate) == weakETag(etag) {
+			return true
+		}
+	}
+	return false
+}
+
+func weakETag(etag string) string {
+	return strings.TrimPrefix(etag, "W/")
+}
+
+// updateHeader replaces the headers of a stored response by the ones of the 304 Not Modified revalidating it
+func updateHeader(stored, notModified http.Header) {
+	for k, v := range notModified {
+		if !skippedUpdateHeaders[k] {
+			stored[k] = append([]string(nil), v...)
+		}
+	}
+}
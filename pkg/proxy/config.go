@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"fmt"
+	"time"
+
+	cachev1beta1 "service-cache-operator/pkg/apis/cache/v1beta1"
+	"service-cache-operator/pkg/cachekey"
+	"service-cache-operator/pkg/httpcache"
+	"service-cache-operator/pkg/store"
+)
+
+// DefaultDiskStorageSize is the capacity of the Disk storage when its size is not set
+const DefaultDiskStorageSize = 1 << 30
+
+// NewConfig returns the caching configuration described by a ServiceCache object
+func NewConfig(sc *cachev1beta1.ServiceCache, ttl time.Duration) Config {
+	config := Config{
+		CacheableByDefault: sc.Spec.CacheableByDefault,
+		URLs:               append([]string(nil), sc.Spec.URLs...),
+		TTL:                ttl,
+		HeaderPolicy:       httpcache.Policy(sc.Spec.HeaderPolicy),
+	}
+	if sc.Spec.StaleWhileRevalidate != nil {
+		config.StaleWhileRevalidate = sc.Spec.StaleWhileRevalidate.Duration
+	}
+	if sc.Spec.StaleIfError != nil {
+		config.StaleIfError = sc.Spec.StaleIfError.Duration
+	}
+	if key := sc.Spec.CacheKey; key != nil {
+		config.CacheKey.Host = key.IncludeHost
+		if key.Query != nil {
+			config.CacheKey.Query = &cachekey.Query{
+				Include:       append([]string(nil), key.Query.Include...),
+				Exclude:       append([]string(nil), key.Query.Exclude...),
+				PreserveOrder: key.Query.PreserveOrder,
+			}
+		}
+		for _, h := range key.Headers {
+			config.CacheKey.Headers = append(config.CacheKey.Headers, cachekey.Field{Name: h.Name, Hash: h.Hash})
+		}
+		for _, c := range key.Cookies {
+			config.CacheKey.Cookies = append(config.CacheKey.Cookies, cachekey.Field{Name: c.Name, Hash: c.Hash})
+		}
+	}
+	if sc.Spec.Coalescing != nil {
+		config.Coalesce = true
+		if sc.Spec.Coalescing.WaitTimeout != nil {
+			config.CoalesceTimeout = sc.Spec.Coalescing.WaitTimeout.Duration
+		}
+	}
+	if sc.Spec.Invalidation != nil {
+		config.InvalidateOnUnsafeMethods = sc.Spec.Invalidation.UnsafeMethods
+		config.InvalidateLocations = sc.Spec.Invalidation.Locations
+	}
+	// the cache generation is incremented by the operator when the pods of the Service roll out a new version
+	config.CacheGeneration = sc.Status.CacheGeneration
+	for _, r := range sc.Spec.Rules {
+		rule := Rule{
+			Path:     r.Path,
+			PathType: PathMatchType(r.PathType),
+			Methods:  append([]string(nil), r.Methods...),
+			Vary:     append([]string(nil), r.Vary...),
+		}
+		if r.TTL != nil {
+			rule.TTL = r.TTL.Duration
+		}
+		config.Rules = append(config.Rules, rule)
+	}
+	return config
+}
+
+// NewStore returns the store of the cached responses described by a ServiceCache object.
+// dir is where the Disk storage writes the responses, password authenticates to the server of the Redis storage.
+func NewStore(sc *cachev1beta1.ServiceCache, dir, password string) (store.Store, error) {
+	storage := sc.Spec.Storage
+	if storage == nil {
+		storage = &cachev1beta1.CacheStorage{}
+	}
+	switch storage.Type {
+	case "", cachev1beta1.StorageMemory:
+		maxSize := int64(DefaultStorageSize)
+		if storage.MaxSize != nil {
+			maxSize = storage.MaxSize.Value()
+		}
+		return store.NewMemory(maxSize, store.DefaultShards), nil
+	case cachev1beta1.StorageDisk:
+		maxSize := int64(DefaultDiskStorageSize)
+		if storage.MaxSize != nil {
+			maxSize = storage.MaxSize.Value()
+		}
+		return store.NewDisk(dir, maxSize)
+	case cachev1beta1.StorageRedis:
+		if storage.Redis == nil {
+			return nil, fmt.Errorf("the Redis storage requires a server")
+		}
+		return store.NewRedis(store.RedisOptions{
+			Address:  storage.Redis.Address,
+			Password: password,
+			Database: int(storage.Redis.Database),
+			// the proxies of several Services may share a server
+			KeyPrefix: fmt.Sprintf("service-cache:%s/%s:", sc.Namespace, sc.Name),
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown storage type %q", storage.Type)
+}
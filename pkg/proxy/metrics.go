@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"strconv"
+	"time"
+
+	"service-cache-operator/pkg/httpcache"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics exports the metrics of the cache of a Proxy to Prometheus. They are labeled with the namespace and the name
+// of the ServiceCache of the proxy, and with the path of the rule matching the requests.
+// It's set as the Metrics of the Proxy, and registered as a prometheus.Collector.
+type Metrics struct {
+	proxy *Proxy
+
+	responses      *prometheus.CounterVec
+	originDuration *prometheus.HistogramVec
+	revalidations  *prometheus.CounterVec
+
+	// the metrics of the store are read from it at every scrape
+	entries   *prometheus.Desc
+	bytes     *prometheus.Desc
+	evictions *prometheus.Desc
+}
+
+// NewMetrics returns the metrics of p, the proxy configured by the ServiceCache name in namespace
+func NewMetrics(p *Proxy, namespace, name string) *Metrics {
+	labels := prometheus.Labels{"namespace": namespace, "servicecache": name}
+	return &Metrics{
+		proxy: p,
+		responses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "service_cache_responses_total",
+			Help:        "Responses to the cacheable requests by cache status: HIT, MISS, STALE, REVALIDATED or COALESCED.",
+			ConstLabels: labels,
+		}, []string{"rule", "cache_status"}),
+		originDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "service_cache_origin_request_duration_seconds",
+			Help:        "Duration of the requests of cacheable responses to the origin, by status code.",
+			ConstLabels: labels,
+			Buckets:     prometheus.DefBuckets,
+		}, []string{"rule", "code"}),
+		revalidations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "service_cache_revalidations_total",
+			Help:        "Conditional requests to the origin by result: not_modified when the cached response is still valid, modified otherwise.",
+			ConstLabels: labels,
+		}, []string{"rule", "result"}),
+		entries: prometheus.NewDesc("service_cache_entries",
+			"Cached responses in the store, including the stale ones kept to be revalidated. Counted once a minute by the Redis storage.", nil, labels),
+		bytes: prometheus.NewDesc("service_cache_stored_bytes",
+			"Size of the cached responses in the store. Not reported by the Redis storage.", nil, labels),
+		evictions: prometheus.NewDesc("service_cache_evictions_total",
+			"Cached responses deleted to make room for others. Not reported by the Redis storage.", nil, labels),
+	}
+}
+
+// Served implements httpcache.Metrics
+func (m *Metrics) Served(opts httpcache.Options, cacheStatus string) {
+	m.responses.WithLabelValues(opts.Rule, cacheStatus).Inc()
+}
+
+// OriginRequested implements httpcache.Metrics
+func (m *Metrics) OriginRequested(opts httpcache.Options, status int, duration time.Duration) {
+	m.originDuration.WithLabelValues(opts.Rule, strconv.Itoa(status)).Observe(duration.Seconds())
+}
+
+// Revalidated implements httpcache.Metrics
+func (m *Metrics) Revalidated(opts httpcache.Options, notModified bool) {
+	result := "modified"
+	if notModified {
+		result = "not_modified"
+	}
+	m.revalidations.WithLabelValues(opts.Rule, result).Inc()
+}
+
+// Describe implements prometheus.Collector
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.responses.Describe(ch)
+	m.originDuration.Describe(ch)
+	m.revalidations.Describe(ch)
+	ch <- m.entries
+	ch <- m.bytes
+	ch <- m.evictions
+}
+
+// Collect implements prometheus.Collector
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.responses.Collect(ch)
+	m.originDuration.Collect(ch)
+	m.revalidations.Collect(ch)
+
+	stats, err := m.proxy.Store().Stats()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(m.entries, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(m.entries, prometheus.GaugeValue, float64(stats.Entries))
+	if stats.Bytes >= 0 {
+		ch <- prometheus.MustNewConstMetric(m.bytes, prometheus.GaugeValue, float64(stats.Bytes))
+	}
+	if stats.Evictions >= 0 {
+		ch <- prometheus.MustNewConstMetric(m.evictions, prometheus.CounterValue, float64(stats.Evictions))
+	}
+}
@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	origin := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, "item")
+	})
+	p := NewWithOrigin(origin, Config{Rules: []Rule{{Path: "/items"}}})
+	m := NewMetrics(p, "default", "my-service")
+	p.Metrics = m
+
+	for _, target := range []string{"/items/1", "/items/1", "/other"} {
+		p.ServeHTTP(httptest.NewRecorder(), request("GET", target))
+	}
+	// the cache status of the responses, by rule, with the labels of the ServiceCache
+	expected := `
+# HELP service_cache_responses_total Responses to the cacheable requests by cache status: HIT, MISS, STALE, REVALIDATED or COALESCED.
+# TYPE service_cache_responses_total counter
+service_cache_responses_total{cache_status="HIT",namespace="default",rule="/items",servicecache="my-service"} 1
+service_cache_responses_total{cache_status="MISS",namespace="default",rule="/items",servicecache="my-service"} 1
+# HELP service_cache_entries Cached responses in the store, including the stale ones kept to be revalidated. Counted once a minute by the Redis storage.
+# TYPE service_cache_entries gauge
+service_cache_entries{namespace="default",servicecache="my-service"} 1
+# HELP service_cache_evictions_total Cached responses deleted to make room for others. Not reported by the Redis storage.
+# TYPE service_cache_evictions_total counter
+service_cache_evictions_total{namespace="default",servicecache="my-service"} 0
+`
+	err := testutil.CollectAndCompare(m, strings.NewReader(expected),
+		"service_cache_responses_total", "service_cache_entries", "service_cache_evictions_total")
+	if err != nil {
+		t.Error(err)
+	}
+}
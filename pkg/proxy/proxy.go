@@ -0,0 +1,147 @@
+// Package proxy implements the caching reverse proxy which serves the traffic of a cached Service.
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"reflect"
+	"sync"
+	"time"
+
+	"service-cache-operator/pkg/cachekey"
+	"service-cache-operator/pkg/httpcache"
+	"service-cache-operator/pkg/store"
+)
+
+// HeaderCacheStatus is the response header telling clients whether the response was served from the cache
+const HeaderCacheStatus = httpcache.HeaderCacheStatus
+
+// DefaultTTL is how long a response is cached when Config.TTL is not set
+const DefaultTTL = 60 * time.Second
+
+// DefaultStorageSize is the capacity of the in-memory store of a Proxy when no store is set
+const DefaultStorageSize = 64 << 20
+
+// Config is the caching configuration of a Proxy, usually built from a ServiceCache object.
+type Config struct {
+	// CacheableByDefault makes every GET response cacheable, not only the ones listed in URLs
+	CacheableByDefault bool
+	// URLs are the cacheable paths. A path ending with "*" matches every path with that prefix
+	URLs []string
+	// Rules are the cacheable requests, in addition to URLs. The first matching rule applies
+	Rules []Rule
+	// TTL is how long a cached response is served before the origin is asked again
+	TTL time.Duration
+	// HeaderPolicy is how the caching headers of the responses and of the requests combine with the TTL,
+	// httpcache.PolicyStricter if empty
+	HeaderPolicy httpcache.Policy
+	// StaleWhileRevalidate is how long an expired response is still served while it's refreshed in the background
+	StaleWhileRevalidate time.Duration
+	// StaleIfError is how long an expired response is still served when the origin fails
+	StaleIfError time.Duration
+	// Coalesce makes the concurrent requests missing the same response wait for a single request to the origin
+	Coalesce bool
+	// CoalesceTimeout is how long a request waits for a concurrent request to the origin,
+	// httpcache.DefaultCoalesceTimeout if not set
+	CoalesceTimeout time.Duration
+	// CacheKey tells which parts of the requests are in the cache key, in addition to the Vary headers of the rules
+	CacheKey cachekey.Config
+	// InvalidateOnUnsafeMethods makes the successful requests with an unsafe method, e.g. POST, to a path matched by a
+	// rule delete the cached responses of that path
+	InvalidateOnUnsafeMethods bool
+	// InvalidateLocations also deletes the cached responses of the Location and Content-Location of their responses
+	InvalidateLocations bool
+	// CacheGeneration is part of the cache keys, like the rest of the configuration: changing it stops serving the
+	// responses cached before
+	CacheGeneration int64
+}
+
+// Proxy is a caching reverse proxy which sits in front of the endpoints of a Service.
+type Proxy struct {
+	// Handler serves the cacheable requests from the cache, and forwards the other ones to the origin. Its ErrorLog and
+	// StaleRetention can be set before serving.
+	*httpcache.Handler
+
+	mu     sync.RWMutex
+	config Config
+	rules  []*compiledRule
+	// keyPrefix is a hash of config, so that the responses cached with a previous configuration are not served
+	keyPrefix string
+}
+
+// New returns a Proxy forwarding the requests to target, and caching the responses according to config.
+func New(target *url.URL, config Config) *Proxy {
+	return NewWithOrigin(httputil.NewSingleHostReverseProxy(target), config)
+}
+
+// NewWithOrigin returns a Proxy forwarding the requests it cannot answer from the cache to origin.
+func NewWithOrigin(origin http.Handler, config Config) *Proxy {
+	p := &Proxy{
+		config:    config,
+		rules:     compileRules(config),
+		keyPrefix: configHash(config),
+	}
+	p.Handler = httpcache.NewHandler(origin, p.match, store.NewMemory(DefaultStorageSize, store.DefaultShards))
+	return p
+}
+
+// SetConfig replaces the caching configuration. The responses cached with the previous configuration are not served
+// anymore: they are left to expire, since the store may be shared with proxies not reconfigured yet.
+func (p *Proxy) SetConfig(config Config) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if reflect.DeepEqual(p.config, config) {
+		return
+	}
+	p.config = config
+	p.rules = compileRules(config)
+	p.keyPrefix = configHash(config)
+}
+
+// match returns how the response to req is cached according to the first matching rule, and false if it's not
+// cacheable. A request with an unsafe method to the path of a rule which doesn't cache it invalidates that path.
+func (p *Proxy) match(req *http.Request) (httpcache.Options, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	invalidate := false
+	for _, rule := range p.rules {
+		if !rule.matches(req) {
+			if p.config.InvalidateOnUnsafeMethods && !httpcache.IsSafeMethod(req.Method) && rule.matchesPath(req) {
+				invalidate = true
+			}
+			continue
+		}
+		ttl := rule.TTL
+		if ttl <= 0 {
+			ttl = p.config.TTL
+		}
+		if ttl <= 0 {
+			ttl = DefaultTTL
+		}
+		return httpcache.Options{
+			Key:                  p.keyPrefix + ":" + rule.key(req),
+			Rule:                 rule.Path,
+			TTL:                  ttl,
+			Policy:               p.config.HeaderPolicy,
+			StaleWhileRevalidate: p.config.StaleWhileRevalidate,
+			StaleIfError:         p.config.StaleIfError,
+			Coalesce:             p.config.Coalesce,
+			CoalesceTimeout:      p.config.CoalesceTimeout,
+		}, true
+	}
+	if invalidate {
+		return httpcache.Options{Invalidate: true, InvalidateLocations: p.config.InvalidateLocations}, true
+	}
+	return httpcache.Options{}, false
+}
+
+// configHash returns a short hash of config
+func configHash(config Config) string {
+	value, _ := json.Marshal(config)
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:4])
+}
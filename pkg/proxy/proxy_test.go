@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"service-cache-operator/pkg/httpcache"
+)
+
+func TestMatch(t *testing.T) {
+	rules := []Rule{
+		{Path: "/items", TTL: time.Minute},
+		{Path: "/users", PathType: PathMatchExact},
+	}
+	tests := []struct {
+		name   string
+		config Config
+		req    *http.Request
+		want   httpcache.Options
+		ok     bool
+	}{
+		{"rule ttl", Config{Rules: rules}, request("GET", "/items/1"),
+			httpcache.Options{Rule: "/items", TTL: time.Minute}, true},
+		{"config ttl", Config{Rules: rules, TTL: time.Hour}, request("GET", "/users"),
+			httpcache.Options{Rule: "/users", TTL: time.Hour}, true},
+		{"default ttl", Config{Rules: rules}, request("GET", "/users"),
+			httpcache.Options{Rule: "/users", TTL: DefaultTTL}, true},
+		{"not cacheable", Config{Rules: rules}, request("GET", "/orders"), httpcache.Options{}, false},
+		{"unsafe method", Config{Rules: rules}, request("POST", "/items/1"), httpcache.Options{}, false},
+		{"invalidation", Config{Rules: rules, InvalidateOnUnsafeMethods: true}, request("DELETE", "/items/1"),
+			httpcache.Options{Invalidate: true}, true},
+		{"invalidation of the locations", Config{Rules: rules, InvalidateOnUnsafeMethods: true, InvalidateLocations: true},
+			request("POST", "/users"), httpcache.Options{Invalidate: true, InvalidateLocations: true}, true},
+		{"invalidation of another path", Config{Rules: rules, InvalidateOnUnsafeMethods: true}, request("POST", "/orders"),
+			httpcache.Options{}, false},
+		{"safe method not cached", Config{Rules: []Rule{{Path: "/items", Methods: []string{"HEAD"}}}, InvalidateOnUnsafeMethods: true},
+			request("GET", "/items"), httpcache.Options{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := NewWithOrigin(http.NotFoundHandler(), test.config)
+			got, ok := p.match(test.req)
+			if ok != test.ok {
+				t.Fatalf("match = %v, want %v", ok, test.ok)
+			}
+			// the key is tested with the rules, here only its prefix
+			if ok && !test.want.Invalidate && !strings.HasPrefix(got.Key, p.keyPrefix+":GET "+test.req.URL.Path) {
+				t.Errorf("Key = %q, want the key of the rule prefixed by the hash of the configuration", got.Key)
+			}
+			got.Key = ""
+			if got != test.want {
+				t.Errorf("match = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMatchFirstRule(t *testing.T) {
+	p := NewWithOrigin(http.NotFoundHandler(), Config{
+		URLs:               []string{"/items/*"},
+		Rules:              []Rule{{Path: "/items/1", TTL: time.Minute}},
+		CacheableByDefault: true,
+	})
+	tests := []struct {
+		target string
+		rule   string
+	}{
+		{"/items/1", "/items/"},
+		{"/other", "/"},
+	}
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			opts, ok := p.match(request("GET", test.target))
+			if !ok || opts.Rule != test.rule {
+				t.Errorf("match = %+v, %v, want the rule %q", opts, ok, test.rule)
+			}
+		})
+	}
+}
+
+func TestSetConfigChangesKeys(t *testing.T) {
+	config := Config{CacheableByDefault: true}
+	p := NewWithOrigin(http.NotFoundHandler(), config)
+	before, _ := p.match(request("GET", "/items"))
+	p.SetConfig(config)
+	if same, _ := p.match(request("GET", "/items")); same.Key != before.Key {
+		t.Errorf("the same configuration changed the key from %q to %q", before.Key, same.Key)
+	}
+	config.CacheGeneration++
+	p.SetConfig(config)
+	if after, _ := p.match(request("GET", "/items")); after.Key == before.Key {
+		t.Errorf("the new cache generation kept the key %q", after.Key)
+	}
+}
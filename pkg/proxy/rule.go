@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"service-cache-operator/pkg/cachekey"
+)
+
+// PathMatchType is how the path of a Rule is matched against the path of a request
+type PathMatchType string
+
+const (
+	// PathMatchExact matches the requests with exactly the path
+	PathMatchExact PathMatchType = "Exact"
+	// PathMatchPrefix matches the requests whose path starts with the path
+	PathMatchPrefix PathMatchType = "Prefix"
+	// PathMatchRegex matches the requests whose path matches the regular expression
+	PathMatchRegex PathMatchType = "Regex"
+)
+
+// Rule describes which requests are cached and for how long
+type Rule struct {
+	// Path is matched against the path of the request according to PathType
+	Path string
+	// PathType is how Path is matched, PathMatchPrefix if empty
+	PathType PathMatchType
+	// Methods are the cacheable HTTP methods, GET or HEAD, both if empty
+	Methods []string
+	// TTL is how long a response is cached, Config.TTL if zero
+	TTL time.Duration
+	// Vary are the request headers which are part of the cache key
+	Vary []string
+}
+
+// compiledRule is a Rule ready to match requests
+type compiledRule struct {
+	Rule
+	regexp *regexp.Regexp
+	keys   *cachekey.Builder
+}
+
+// compileRules returns the rules of config, the legacy URLs first, ready to match requests.
+// Rules with an invalid regular expression never match.
+func compileRules(config Config) []*compiledRule {
+	var rules []*compiledRule
+	for _, u := range config.URLs {
+		u = strings.TrimSpace(u)
+		if u == "" {
+			continue
+		}
+		rule := Rule{Path: u, PathType: PathMatchExact}
+		if strings.HasSuffix(u, "*") {
+			rule = Rule{Path: strings.TrimSuffix(u, "*"), PathType: PathMatchPrefix}
+		}
+		rules = append(rules, &compiledRule{Rule: rule})
+	}
+	for _, rule := range config.Rules {
+		compiled := &compiledRule{Rule: rule}
+		if rule.PathType == PathMatchRegex {
+			re, err := regexp.Compile(rule.Path)
+			if err != nil {
+				continue
+			}
+			compiled.regexp = re
+		}
+		rules = append(rules, compiled)
+	}
+	if config.CacheableByDefault {
+		rules = append(rules, &compiledRule{Rule: Rule{Path: "/", PathType: PathMatchPrefix}})
+	}
+
+	// the headers listed in the Vary of a rule are added to the ones of the cache key configuration
+	for _, rule := range rules {
+		keyConfig := config.CacheKey
+		keyConfig.Headers = append([]cachekey.Field(nil), config.CacheKey.Headers...)
+		for _, h := range rule.Vary {
+			keyConfig.Headers = append(keyConfig.Headers, cachekey.Field{Name: h})
+		}
+		rule.keys = cachekey.New(keyConfig)
+	}
+	return rules
+}
+
+// matches returns true if the request is cacheable by the rule
+func (r *compiledRule) matches(req *http.Request) bool {
+	return r.allowsMethod(req.Method) && r.matchesPath(req)
+}
+
+// matchesPath returns true if the path of the request is matched by the rule, whatever its method
+func (r *compiledRule) matchesPath(req *http.Request) bool {
+	switch r.PathType {
+	case PathMatchExact:
+		return req.URL.Path == r.Path
+	case PathMatchRegex:
+		return r.regexp.MatchString(req.URL.Path)
+	default:
+		return strings.HasPrefix(req.URL.Path, r.Path)
+	}
+}
+
+// allowsMethod returns true if the rule caches the responses to method, which must be GET or HEAD
+func (r *compiledRule) allowsMethod(method string) bool {
+	if method != http.MethodGet && method != http.MethodHead {
+		return false
+	}
+	if len(r.Methods) == 0 {
+		return true
+	}
+	for _, m := range r.Methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// key returns the cache key of the request, which includes the headers listed in Vary
+func (r *compiledRule) key(req *http.Request) string {
+	return r.keys.Key(req)
+}
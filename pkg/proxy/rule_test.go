@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"service-cache-operator/pkg/cachekey"
+)
+
+func request(method, target string, header ...string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Add(header[i], header[i+1])
+	}
+	return req
+}
+
+func TestCompileRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   []string
+	}{
+		{"none", Config{}, nil},
+		{"legacy URLs", Config{URLs: []string{"/a", " /b* ", ""}}, []string{"Exact /a", "Prefix /b"}},
+		{"order", Config{URLs: []string{"/legacy"}, Rules: []Rule{{Path: "/api"}, {Path: "/items", PathType: PathMatchExact}},
+			CacheableByDefault: true}, []string{"Exact /legacy", " /api", "Exact /items", "Prefix /"}},
+		{"invalid regex", Config{Rules: []Rule{{Path: "(", PathType: PathMatchRegex}, {Path: "^/ok$", PathType: PathMatchRegex}}},
+			[]string{"Regex ^/ok$"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, rule := range compileRules(test.config) {
+				got = append(got, string(rule.PathType)+" "+rule.Path)
+			}
+			if strings.Join(got, ",") != strings.Join(test.want, ",") {
+				t.Errorf("compileRules = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		req  *http.Request
+		want bool
+	}{
+		{"exact", Rule{Path: "/items", PathType: PathMatchExact}, request("GET", "/items?page=2"), true},
+		{"exact other path", Rule{Path: "/items", PathType: PathMatchExact}, request("GET", "/items/1"), false},
+		{"prefix", Rule{Path: "/items", PathType: PathMatchPrefix}, request("GET", "/items/1"), true},
+		{"prefix by default", Rule{Path: "/items"}, request("GET", "/items/1"), true},
+		{"prefix other path", Rule{Path: "/items"}, request("GET", "/users"), false},
+		{"regex", Rule{Path: "^/items/[0-9]+$", PathType: PathMatchRegex}, request("GET", "/items/42"), true},
+		{"regex other path", Rule{Path: "^/items/[0-9]+$", PathType: PathMatchRegex}, request("GET", "/items/new"), false},
+		{"HEAD by default", Rule{Path: "/"}, request("HEAD", "/items"), true},
+		{"POST by default", Rule{Path: "/"}, request("POST", "/items"), false},
+		{"methods", Rule{Path: "/", Methods: []string{"head"}}, request("HEAD", "/items"), true},
+		{"other method", Rule{Path: "/", Methods: []string{"HEAD"}}, request("GET", "/items"), false},
+		{"unsafe method", Rule{Path: "/", Methods: []string{"POST"}}, request("POST", "/items"), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules := compileRules(Config{Rules: []Rule{test.rule}})
+			if got := rules[0].matches(test.req); got != test.want {
+				t.Errorf("matches = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRuleKey(t *testing.T) {
+	config := Config{
+		Rules: []Rule{
+			{Path: "/items", Vary: []string{"accept-language"}},
+			{Path: "/users"},
+		},
+		CacheKey: cachekey.Config{Headers: []cachekey.Field{{Name: "X-Tenant"}}},
+	}
+	rules := compileRules(config)
+	tests := []struct {
+		name string
+		rule *compiledRule
+		req  *http.Request
+		want string
+	}{
+		{"vary after the key headers", rules[0], request("GET", "/items", "X-Tenant", "a", "Accept-Language", "en"),
+			"GET /items\nX-Tenant: a\nAccept-Language: en"},
+		{"without vary", rules[1], request("GET", "/users", "X-Tenant", "a", "Accept-Language", "en"),
+			"GET /users\nX-Tenant: a"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.rule.key(test.req); got != test.want {
+				t.Errorf("key = %q, want %q", got, test.want)
+			}
+		})
+	}
+	if len(config.CacheKey.Headers) != 1 {
+		t.Errorf("the Vary of the rules changed the key configuration: %v", config.CacheKey.Headers)
+	}
+}
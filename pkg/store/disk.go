@@ -0,0 +1,218 @@
+package store
+
+import (
+	"container/list"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// diskDirPrefix is the prefix of the directories of the Disk stores, the other files of their parent are left alone
+const diskDirPrefix = "store-"
+
+// processID tells the directories of the Disk stores of this process from the ones left by previous processes
+var processID = func() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}()
+
+// Disk is a Store keeping the values in files, for values too large to be kept in memory.
+// The index of the values is in memory, so the values don't survive a restart.
+// The least recently used values are evicted when it's full.
+type Disk struct {
+	dir      string
+	maxBytes int64
+
+	mu        sync.Mutex
+	bytes     int64
+	evictions int64
+	lru       *list.List
+	items     map[string]*list.Element
+}
+
+type diskItem struct {
+	key     string
+	file    string
+	size    int64
+	expires time.Time
+}
+
+// NewDisk returns a Disk store holding up to maxBytes of values in a new directory of parent.
+// The directories left in parent by the Disk stores of previous processes are deleted.
+func NewDisk(parent string, maxBytes int64) (*Disk, error) {
+	if err := os.MkdirAll(parent, 0700); err != nil {
+		return nil, err
+	}
+	if err := removeStaleDirs(parent); err != nil {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir(parent, diskDirPrefix+processID+"-")
+	if err != nil {
+		return nil, err
+	}
+	return &Disk{
+		dir:      dir,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		items:    make(map[string]*list.Element),
+	}, nil
+}
+
+// Get implements Store
+func (d *Disk) Get(key string) ([]byte, bool, error) {
+	d.mu.Lock()
+	e, ok := d.items[key]
+	if !ok {
+		d.mu.Unlock()
+		return nil, false, nil
+	}
+	item := e.Value.(*diskItem)
+	if expired(item.expires, time.Now()) {
+		d.remove(e)
+		d.mu.Unlock()
+		return nil, false, nil
+	}
+	d.lru.MoveToFront(e)
+	d.mu.Unlock()
+
+	// the file is replaced atomically by Set, so it's read without the lock
+	value, err := ioutil.ReadFile(item.file)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set implements Store
+func (d *Disk) Set(key string, value []byte, ttl time.Duration) error {
+	size := int64(len(value))
+	if size > d.maxBytes {
+		return ErrTooLarge
+	}
+
+	// write a temporary file, then rename it so that readers never see a partial value
+	tmp, err := ioutil.TempFile(d.dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(value)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.items[key]; ok {
+		d.remove(e)
+	}
+	for d.bytes+size > d.maxBytes {
+		d.remove(d.lru.Back())
+		d.evictions++
+	}
+	item := &diskItem{key: key, file: d.fileOf(key), size: size, expires: expiration(ttl)}
+	if err := os.Rename(tmp.Name(), item.file); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	d.items[key] = d.lru.PushFront(item)
+	d.bytes += size
+	return nil
+}
+
+// Delete implements Store
+func (d *Disk) Delete(key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.items[key]; ok {
+		d.remove(e)
+	}
+	return nil
+}
+
+// Purge implements Store
+func (d *Disk) Purge() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for e := d.lru.Front(); e != nil; e = d.lru.Front() {
+		d.remove(e)
+	}
+	return nil
+}
+
+// Keys implements Store. The keys are copied, so that f runs without holding the lock of the store.
+func (d *Disk) Keys(f func(key string) error) error {
+	d.mu.Lock()
+	keys := make([]string, 0, len(d.items))
+	for key := range d.items {
+		keys = append(keys, key)
+	}
+	d.mu.Unlock()
+	for _, key := range keys {
+		if err := f(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stats implements Store
+func (d *Disk) Stats() (Stats, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return Stats{Entries: int64(len(d.items)), Bytes: d.bytes, Evictions: d.evictions}, nil
+}
+
+// Close implements Store. It deletes the directory of the store.
+func (d *Disk) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lru.Init()
+	d.items = make(map[string]*list.Element)
+	d.bytes = 0
+	return os.RemoveAll(d.dir)
+}
+
+// fileOf returns the file of the value of key. Keys are hashed since they may be long or contain slashes.
+func (d *Disk) fileOf(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:]))
+}
+
+// remove must be called with d.mu held
+func (d *Disk) remove(e *list.Element) {
+	item := d.lru.Remove(e).(*diskItem)
+	delete(d.items, item.key)
+	d.bytes -= item.size
+	os.Remove(item.file)
+}
+
+// removeStaleDirs deletes the directories of the Disk stores of the previous processes
+func removeStaleDirs(parent string) error {
+	files, err := ioutil.ReadDir(parent)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() && strings.HasPrefix(name, diskDirPrefix) && !strings.HasPrefix(name, diskDirPrefix+processID+"-") {
+			if err := os.RemoveAll(filepath.Join(parent, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package store
+
+import (
+	"container/list"
+	"hash/fnv"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultShards is the number of shards of a Memory store when it's not set
+const DefaultShards = 16
+
+// Memory is a Store keeping the values in memory. The least recently used values are evicted when it's full.
+// The keys are spread over shards, each one with its own lock, which share the capacity: a value may take all of it.
+type Memory struct {
+	// bytes is the size of the values of all the shards, and clock orders their uses. They are accessed atomically.
+	bytes int64
+	clock int64
+
+	maxBytes int64
+	shards   []*memoryShard
+}
+
+type memoryShard struct {
+	mu sync.Mutex
+	// total is the bytes of the Memory store
+	total     *int64
+	bytes     int64
+	evictions int64
+	lru       *list.List
+	items     map[string]*list.Element
+}
+
+type memoryItem struct {
+	key     string
+	value   []byte
+	expires time.Time
+	// used is the clock of the store when the item was last used
+	used int64
+}
+
+func (i *memoryItem) size() int64 {
+	return int64(len(i.key) + len(i.value))
+}
+
+// NewMemory returns a Memory store holding up to maxBytes of keys and values, spread over shards
+func NewMemory(maxBytes int64, shards int) *Memory {
+	if shards <= 0 {
+		shards = DefaultShards
+	}
+	m := &Memory{maxBytes: maxBytes, shards: make([]*memoryShard, shards)}
+	for i := range m.shards {
+		m.shards[i] = &memoryShard{
+			total: &m.bytes,
+			lru:   list.New(),
+			items: make(map[string]*list.Element),
+		}
+	}
+	return m
+}
+
+func (m *Memory) shard(key string) *memoryShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return m.shards[h.Sum32()%uint32(len(m.shards))]
+}
+
+// Get implements Store
+func (m *Memory) Get(key string) ([]byte, bool, error) {
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	item := e.Value.(*memoryItem)
+	if expired(item.expires, time.Now()) {
+		s.remove(e)
+		return nil, false, nil
+	}
+	item.used = atomic.AddInt64(&m.clock, 1)
+	s.lru.MoveToFront(e)
+	return item.value, true, nil
+}
+
+// Set implements Store
+func (m *Memory) Set(key string, value []byte, ttl time.Duration) error {
+	item := &memoryItem{key: key, value: value, expires: expiration(ttl)}
+	if item.size() > m.maxBytes {
+		return ErrTooLarge
+	}
+	s := m.shard(key)
+	s.mu.Lock()
+	if e, ok := s.items[key]; ok {
+		s.remove(e)
+	}
+	item.used = atomic.AddInt64(&m.clock, 1)
+	s.items[key] = s.lru.PushFront(item)
+	s.bytes += item.size()
+	atomic.AddInt64(&m.bytes, item.size())
+	s.mu.Unlock()
+	m.evict()
+	return nil
+}
+
+// evict removes the least recently used values of all the shards until they fit in the store. The shards are locked
+// one at a time.
+func (m *Memory) evict() {
+	for atomic.LoadInt64(&m.bytes) > m.maxBytes {
+		var oldest *memoryShard
+		oldestUse := int64(math.MaxInt64)
+		for _, s := range m.shards {
+			s.mu.Lock()
+			if back := s.lru.Back(); back != nil && back.Value.(*memoryItem).used < oldestUse {
+				oldest, oldestUse = s, back.Value.(*memoryItem).used
+			}
+			s.mu.Unlock()
+		}
+		if oldest == nil {
+			return
+		}
+		oldest.mu.Lock()
+		// the value may have been used or removed meanwhile
+		if back := oldest.lru.Back(); back != nil && back.Value.(*memoryItem).used == oldestUse {
+			oldest.remove(back)
+			oldest.evictions++
+		}
+		oldest.mu.Unlock()
+	}
+}
+
+// Delete implements Store
+func (m *Memory) Delete(key string) error {
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[key]; ok {
+		s.remove(e)
+	}
+	return nil
+}
+
+// Purge implements Store
+func (m *Memory) Purge() error {
+	for _, s := range m.shards {
+		s.mu.Lock()
+		s.lru.Init()
+		s.items = make(map[string]*list.Element)
+		atomic.AddInt64(s.total, -s.bytes)
+		s.bytes = 0
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// Keys implements Store. The keys of a shard are copied, so that f runs without holding its lock.
+func (m *Memory) Keys(f func(key string) error) error {
+	for _, s := range m.shards {
+		s.mu.Lock()
+		keys := make([]string, 0, len(s.items))
+		for key := range s.items {
+			keys = append(keys, key)
+		}
+		s.mu.Unlock()
+		for _, key := range keys {
+			if err := f(key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Stats implements Store
+func (m *Memory) Stats() (Stats, error) {
+	stats := Stats{}
+	for _, s := range m.shards {
+		s.mu.Lock()
+		stats.Entries += int64(len(s.items))
+		stats.Bytes += s.bytes
+		stats.Evictions += s.evictions
+		s.mu.Unlock()
+	}
+	return stats, nil
+}
+
+// Close implements Store
+func (m *Memory) Close() error {
+	return m.Purge()
+}
+
+// remove must be called with s.mu held
+func (s *memoryShard) remove(e *list.Element) {
+	item := s.lru.Remove(e).(*memoryItem)
+	delete(s.items, item.key)
+	s.bytes -= item.size()
+	atomic.AddInt64(s.total, -item.size())
+}
@@ -0,0 +1,331 @@
+package store
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRedisPoolSize is the number of idle connections kept by a Redis store when it's not set
+const DefaultRedisPoolSize = 8
+
+// DefaultRedisTimeout is the timeout of the commands of a Redis store when it's not set
+const DefaultRedisTimeout = 2 * time.Second
+
+// redisStatsTTL is how long the Stats of a Redis store are reused, since they scan the keys of the store
+const redisStatsTTL = time.Minute
+
+// RedisOptions are the settings of a Redis store
+type RedisOptions struct {
+	// Address is the host:port of the server
+	Address string
+	// Password authenticates the connections, if not empty
+	Password string
+	// Database is the number of the database of the server
+	Database int
+	// KeyPrefix is prepended to every key, so that several stores can share a database
+	KeyPrefix string
+	// PoolSize is the number of idle connections kept open
+	PoolSize int
+	// Timeout bounds the time to dial the server and to run a command
+	Timeout time.Duration
+}
+
+// Redis is a Store keeping the values in a server speaking the Redis protocol (RESP), so that the replicas of the
+// cache proxy share their cached responses. The server evicts and expires the values.
+type Redis struct {
+	options RedisOptions
+	pool    chan *redisConn
+
+	// statsMu is held during the scans of Stats, so that there is one at a time
+	statsMu sync.Mutex
+	stats   Stats
+	statsAt time.Time
+}
+
+// redisError is an error reply of the server. The connection can still be used.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+var errUnexpectedReply = errors.New("redis: unexpected reply")
+
+// NewRedis returns a Redis store. The connections are opened when needed.
+func NewRedis(options RedisOptions) *Redis {
+	if options.PoolSize <= 0 {
+		options.PoolSize = DefaultRedisPoolSize
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultRedisTimeout
+	}
+	return &Redis{options: options, pool: make(chan *redisConn, options.PoolSize)}
+}
+
+// Get implements Store
+func (r *Redis) Get(key string) ([]byte, bool, error) {
+	reply, err := r.do("GET", r.options.KeyPrefix+key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, errUnexpectedReply
+	}
+	return value, true, nil
+}
+
+// Set implements Store
+func (r *Redis) Set(key string, value []byte, ttl time.Duration) error {
+	args := []interface{}{"SET", r.options.KeyPrefix + key, value}
+	if ms := int64(ttl / time.Millisecond); ms > 0 {
+		args = append(args, "PX", strconv.FormatInt(ms, 10))
+	}
+	_, err := r.do(args...)
+	return err
+}
+
+// Delete implements Store
+func (r *Redis) Delete(key string) error {
+	_, err := r.do("DEL", r.options.KeyPrefix+key)
+	return err
+}
+
+// Purge implements Store. It deletes the keys with the prefix of the store.
+func (r *Redis) Purge() error {
+	return r.scan(func(keys []interface{}) error {
+		_, err := r.do(append([]interface{}{"DEL"}, keys...)...)
+		return err
+	})
+}
+
+// Keys implements Store. It scans the keys with the prefix of the store.
+func (r *Redis) Keys(f func(key string) error) error {
+	return r.scan(func(keys []interface{}) error {
+		for _, key := range keys {
+			k, ok := key.([]byte)
+			if !ok {
+				return errUnexpectedReply
+			}
+			if err := f(strings.TrimPrefix(string(k), r.options.KeyPrefix)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Stats implements Store. The server doesn't tell the size of the values nor which evicted values had the prefix of the
+// store, so Bytes and Evictions are -1. The entries are counted by scanning the keys at most once a minute.
+func (r *Redis) Stats() (Stats, error) {
+	r.statsMu.Lock()
+	defer r.statsMu.Unlock()
+	if !r.statsAt.IsZero() && time.Since(r.statsAt) < redisStatsTTL {
+		return r.stats, nil
+	}
+	stats := Stats{Bytes: -1, Evictions: -1}
+	err := r.scan(func(keys []interface{}) error {
+		stats.Entries += int64(len(keys))
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	r.stats, r.statsAt = stats, time.Now()
+	return stats, nil
+}
+
+// Close implements Store. It closes the idle connections.
+func (r *Redis) Close() error {
+	for {
+		select {
+		case c := <-r.pool:
+			c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// scan calls f with each batch of the keys with the prefix of the store
+func (r *Redis) scan(f func(keys []interface{}) error) error {
+	match := escapeGlob(r.options.KeyPrefix) + "*"
+	cursor := "0"
+	for {
+		reply, err := r.do("SCAN", cursor, "MATCH", match, "COUNT", "1000")
+		if err != nil {
+			return err
+		}
+		page, ok := reply.([]interface{})
+		if !ok || len(page) != 2 {
+			return errUnexpectedReply
+		}
+		next, ok := page[0].([]byte)
+		keys, ok2 := page[1].([]interface{})
+		if !ok || !ok2 {
+			return errUnexpectedReply
+		}
+		if len(keys) > 0 {
+			if err := f(keys); err != nil {
+				return err
+			}
+		}
+		cursor = string(next)
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// do runs a command on a connection of the pool and returns its reply: nil, []byte, int64 or []interface{}
+func (r *Redis) do(args ...interface{}) (interface{}, error) {
+	c, err := r.get()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.do(r.options.Timeout, args...)
+	if _, ok := err.(redisError); err != nil && !ok {
+		// the state of the connection is unknown after an I/O or protocol error
+		c.Close()
+		return nil, err
+	}
+	r.put(c)
+	return reply, err
+}
+
+func (r *Redis) get() (*redisConn, error) {
+	select {
+	case c := <-r.pool:
+		return c, nil
+	default:
+	}
+	conn, err := net.DialTimeout("tcp", r.options.Address, r.options.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{Conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	if r.options.Password != "" {
+		if _, err := c.do(r.options.Timeout, "AUTH", r.options.Password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if r.options.Database != 0 {
+		if _, err := c.do(r.options.Timeout, "SELECT", strconv.Itoa(r.options.Database)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (r *Redis) put(c *redisConn) {
+	select {
+	case r.pool <- c:
+	default:
+		c.Close()
+	}
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// do sends a command as an array of bulk strings, and reads its reply
+func (c *redisConn) do(timeout time.Duration, args ...interface{}) (interface{}, error) {
+	c.SetDeadline(time.Now().Add(timeout))
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		var b []byte
+		switch a := arg.(type) {
+		case string:
+			b = []byte(a)
+		case []byte:
+			b = a
+		default:
+			return nil, fmt.Errorf("redis: unsupported argument type %T", arg)
+		}
+		fmt.Fprintf(c.w, "$%d\r\n", len(b))
+		c.w.Write(b)
+		c.w.WriteString("\r\n")
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, errUnexpectedReply
+	}
+	kind, line := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return []byte(line), nil
+	case '-':
+		return nil, redisError(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		array := make([]interface{}, n)
+		for i := range array {
+			// an error inside an array is returned as an element, the connection stays usable
+			if array[i], err = c.readReply(); err != nil {
+				if e, ok := err.(redisError); ok {
+					array[i] = e
+					continue
+				}
+				return nil, err
+			}
+		}
+		return array, nil
+	}
+	return nil, errUnexpectedReply
+}
+
+// escapeGlob escapes the special characters of the patterns of the SCAN command
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,476 @@
+package store
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is an in-process stand-in for a Redis server. It speaks enough of RESP for the Redis store: AUTH, SELECT,
+// GET, SET with PX, DEL and SCAN with MATCH. Its SCAN pages hold 2 keys, so that the cursor is followed, and its
+// cursor is the creation order of the keys, so that the keys deleted during a SCAN don't hide the others.
+type fakeRedis struct {
+	listener net.Listener
+	password string
+
+	mu    sync.Mutex
+	dbs   map[int]map[string]fakeValue
+	conns map[net.Conn]bool
+	seq   int
+}
+
+type fakeValue struct {
+	value   []byte
+	expires time.Time
+	seq     int
+}
+
+// fakeStatus is a simple string reply, fakeError an error reply
+type fakeStatus string
+type fakeError string
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{listener: l, password: password, dbs: map[int]map[string]fakeValue{}, conns: map[net.Conn]bool{}}
+	go f.serve()
+	return f
+}
+
+func (f *fakeRedis) Addr() string {
+	return f.listener.Addr().String()
+}
+
+func (f *fakeRedis) Close() {
+	f.listener.Close()
+	f.dropConns()
+}
+
+// dropConns closes the connections of the clients, as a restart of the server does
+func (f *fakeRedis) dropConns() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for c := range f.conns {
+		c.Close()
+	}
+}
+
+// keys returns the keys of the database db, with their prefix
+func (f *fakeRedis) keys(db int) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for k := range f.dbs[db] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// expires returns when the key of the database db expires, the zero time if never
+func (f *fakeRedis) expires(db int, key string) time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.dbs[db][key].expires
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.conns[conn] = true
+		f.mu.Unlock()
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		f.mu.Lock()
+		delete(f.conns, conn)
+		f.mu.Unlock()
+	}()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	authenticated := f.password == ""
+	db := 0
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		writeReply(w, f.exec(args, &authenticated, &db))
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// exec runs the command args for a connection authenticated and using the database db
+func (f *fakeRedis) exec(args []string, authenticated *bool, db *int) interface{} {
+	name := strings.ToUpper(args[0])
+	if name == "AUTH" {
+		if len(args) != 2 || args[1] != f.password {
+			return fakeError("WRONGPASS invalid password")
+		}
+		*authenticated = true
+		return fakeStatus("OK")
+	}
+	if !*authenticated {
+		return fakeError("NOAUTH Authentication required.")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	values := f.dbs[*db]
+	if values == nil {
+		values = map[string]fakeValue{}
+		f.dbs[*db] = values
+	}
+	now := time.Now()
+	for k, v := range values {
+		if !v.expires.IsZero() && now.After(v.expires) {
+			delete(values, k)
+		}
+	}
+
+	switch {
+	case name == "SELECT" && len(args) == 2:
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fakeError("ERR invalid DB index")
+		}
+		*db = n
+		return fakeStatus("OK")
+	case name == "GET" && len(args) == 2:
+		v, ok := values[args[1]]
+		if !ok {
+			return nil
+		}
+		return v.value
+	case name == "SET" && (len(args) == 3 || len(args) == 5 && strings.ToUpper(args[3]) == "PX"):
+		v := fakeValue{value: []byte(args[2])}
+		if len(args) == 5 {
+			ms, err := strconv.ParseInt(args[4], 10, 64)
+			if err != nil || ms <= 0 {
+				return fakeError("ERR invalid expire time in 'set' command")
+			}
+			v.expires = now.Add(time.Duration(ms) * time.Millisecond)
+		}
+		if old, ok := values[args[1]]; ok {
+			v.seq = old.seq
+		} else {
+			f.seq++
+			v.seq = f.seq
+		}
+		values[args[1]] = v
+		return fakeStatus("OK")
+	case name == "DEL" && len(args) >= 2:
+		deleted := int64(0)
+		for _, k := range args[1:] {
+			if _, ok := values[k]; ok {
+				delete(values, k)
+				deleted++
+			}
+		}
+		return deleted
+	case name == "SCAN" && len(args) >= 2:
+		cursor, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fakeError("ERR invalid cursor")
+		}
+		pattern := "*"
+		for i := 2; i+1 < len(args); i += 2 {
+			if strings.ToUpper(args[i]) == "MATCH" {
+				pattern = args[i+1]
+			}
+		}
+		var keys []string
+		for k, v := range values {
+			if v.seq >= cursor {
+				keys = append(keys, k)
+			}
+		}
+		sort.Slice(keys, func(i, j int) bool { return values[keys[i]].seq < values[keys[j]].seq })
+		page := []interface{}{}
+		next := 0
+		for _, k := range keys {
+			if len(page) == 2 {
+				next = values[k].seq
+				break
+			}
+			if matchGlob(pattern, k) {
+				page = append(page, []byte(k))
+			}
+		}
+		return []interface{}{[]byte(strconv.Itoa(next)), page}
+	}
+	return fakeError(fmt.Sprintf("ERR unknown command or wrong number of arguments for '%s'", args[0]))
+}
+
+// matchGlob matches s against the SCAN pattern, with the *, ? and \ special characters. The classes are not
+// supported: an unescaped [ never matches, so that a prefix left unescaped is noticed.
+func matchGlob(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if matchGlob(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+			continue
+		case '[':
+			return false
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+		}
+		if len(s) == 0 || s[0] != pattern[0] {
+			return false
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
+
+// readCommand reads a command sent as an array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, errors.New("not an array")
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || n < 1 {
+		return nil, errors.New("invalid array length")
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, errors.New("not a bulk string")
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil || size < 0 {
+			return nil, errors.New("invalid bulk string length")
+		}
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:size])
+	}
+	return args, nil
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case fakeStatus:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case fakeError:
+		fmt.Fprintf(w, "-%s\r\n", v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case []byte:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, e := range v {
+			writeReply(w, e)
+		}
+	}
+}
+
+// newRedis returns a Redis store on the database 1 of a fakeRedis requiring a password, with a key prefix which has
+// special characters of the SCAN patterns. The returned function closes both.
+func newRedis(t *testing.T) (*Redis, *fakeRedis, func()) {
+	f := newFakeRedis(t, "secret")
+	r := NewRedis(RedisOptions{Address: f.Addr(), Password: "secret", Database: 1, KeyPrefix: "cache:[a]*:"})
+	return r, f, func() {
+		r.Close()
+		f.Close()
+	}
+}
+
+func TestRedisKeyPrefix(t *testing.T) {
+	r, f, cleanup := newRedis(t)
+	defer cleanup()
+	other := NewRedis(RedisOptions{Address: f.Addr(), Password: "secret", Database: 1, KeyPrefix: "cache:a"})
+	defer other.Close()
+	if err := r.Set("/items", []byte("1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	// the key of the other store matches the prefix of r if its special characters are not escaped
+	if err := other.Set("*:/items", []byte("2"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.keys(1), []string{"cache:[a]*:/items", "cache:a*:/items"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("the server has the keys %q, want %q", got, want)
+	}
+
+	stats, err := r.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != 1 || stats.Bytes != -1 || stats.Evictions != -1 {
+		t.Errorf("Stats() = %+v, want 1 entry and an unknown size and evictions", stats)
+	}
+	if err := r.Purge(); err != nil {
+		t.Fatal(err)
+	}
+	assertValue(t, r, "/items", nil)
+	assertValue(t, other, "*:/items", []byte("2"))
+}
+
+func TestRedisKeys(t *testing.T) {
+	r, f, cleanup := newRedis(t)
+	defer cleanup()
+	// more keys than a page of SCAN
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		if err := r.Set(key, []byte(key), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := keys(t, r); strings.Join(got, ",") != "a,b,c,d,e" {
+		t.Errorf("Keys = %q, want the keys without the prefix", got)
+	}
+	if len(f.keys(1)) != 5 {
+		t.Errorf("the server has the keys %q, want 5", f.keys(1))
+	}
+}
+
+func TestRedisStatsReused(t *testing.T) {
+	r, _, cleanup := newRedis(t)
+	defer cleanup()
+	if err := r.Set("a", []byte("1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if stats, err := r.Stats(); err != nil || stats.Entries != 1 {
+		t.Fatalf("Stats() = %+v, %v, want 1 entry", stats, err)
+	}
+	if err := r.Set("b", []byte("2"), 0); err != nil {
+		t.Fatal(err)
+	}
+	// the keys are not scanned again at every scrape
+	if stats, err := r.Stats(); err != nil || stats.Entries != 1 {
+		t.Errorf("Stats() = %+v, %v, want the previous 1 entry", stats, err)
+	}
+	r.statsAt = time.Now().Add(-redisStatsTTL)
+	if stats, err := r.Stats(); err != nil || stats.Entries != 2 {
+		t.Errorf("Stats() after a minute = %+v, %v, want 2 entries", stats, err)
+	}
+}
+
+func TestRedisTTL(t *testing.T) {
+	r, f, cleanup := newRedis(t)
+	defer cleanup()
+	if err := r.Set("forever", []byte("1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Set("minute", []byte("2"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if expires := f.expires(1, "cache:[a]*:forever"); !expires.IsZero() {
+		t.Errorf("a value without TTL expires at %v", expires)
+	}
+	if expires := time.Until(f.expires(1, "cache:[a]*:minute")); expires <= 0 || expires > time.Minute {
+		t.Errorf("a value with a TTL of a minute expires in %v", expires)
+	}
+}
+
+func TestRedisAuth(t *testing.T) {
+	f := newFakeRedis(t, "secret")
+	defer f.Close()
+	r := NewRedis(RedisOptions{Address: f.Addr(), Password: "wrong"})
+	defer r.Close()
+	if _, _, err := r.Get("a"); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("Get with a wrong password: got %v, want the error of the server", err)
+	}
+}
+
+func TestRedisErrorReply(t *testing.T) {
+	r, _, cleanup := newRedis(t)
+	defer cleanup()
+	// an error reply keeps the connection usable
+	if _, err := r.do("UNKNOWN"); err == nil {
+		t.Fatal("an unknown command succeeded")
+	}
+	if err := r.Set("a", []byte("1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	assertValue(t, r, "a", []byte("1"))
+}
+
+func TestRedisReconnects(t *testing.T) {
+	r, f, cleanup := newRedis(t)
+	defer cleanup()
+	if err := r.Set("a", []byte("1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	// the idle connection of the pool is broken, it's dropped and the next command dials again
+	f.dropConns()
+	r.Get("a")
+	assertValue(t, r, "a", []byte("1"))
+}
+
+func TestRedisConcurrent(t *testing.T) {
+	f := newFakeRedis(t, "")
+	defer f.Close()
+	r := NewRedis(RedisOptions{Address: f.Addr(), PoolSize: 2})
+	defer r.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key, value := strconv.Itoa(i), []byte(strings.Repeat("x", i))
+			for j := 0; j < 10; j++ {
+				if err := r.Set(key, value, 0); err != nil {
+					errs <- err
+					return
+				}
+				got, ok, err := r.Get(key)
+				if err != nil || !ok || string(got) != string(value) {
+					errs <- fmt.Errorf("Get(%q) = %q, %v, %v", key, got, ok, err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
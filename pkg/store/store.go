@@ -0,0 +1,52 @@
+// Package store implements the storages of the responses cached by the cache proxy.
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrTooLarge is returned when a value is larger than the capacity of the store
+var ErrTooLarge = errors.New("store: value is larger than the capacity of the store")
+
+// Store saves values under keys for a limited time.
+// Its methods are safe for concurrent use.
+type Store interface {
+	// Get returns the value saved under key, false if it's missing or expired. The value must not be modified.
+	Get(key string) ([]byte, bool, error)
+	// Set saves value under key for ttl, replacing the previous value. A zero ttl never expires.
+	Set(key string, value []byte, ttl time.Duration) error
+	// Delete deletes the value saved under key, if any
+	Delete(key string) error
+	// Purge deletes all the values
+	Purge() error
+	// Keys calls f with the key of each value, until f returns an error. The values may be changed meanwhile: f can
+	// get and delete them.
+	Keys(f func(key string) error) error
+	// Stats returns the number of values and their size
+	Stats() (Stats, error)
+	// Close releases the resources of the store, which must not be used anymore
+	Close() error
+}
+
+// Stats are the number of values in a store and their size
+type Stats struct {
+	Entries int64
+	// Bytes is the size of the keys and values, or -1 if the store cannot tell
+	Bytes int64
+	// Evictions is the number of values deleted to make room for others since the store was created, or -1 if the
+	// store cannot tell
+	Evictions int64
+}
+
+// expiration returns when a value saved now for ttl expires, the zero time if it never expires
+func expiration(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+func expired(expires time.Time, now time.Time) bool {
+	return !expires.IsZero() && now.After(expires)
+}
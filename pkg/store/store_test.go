@@ -0,0 +1,269 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// newDisk returns a Disk store in a temporary directory, removed by the returned function
+func newDisk(t *testing.T, maxBytes int64) (*Disk, func()) {
+	parent, err := ioutil.TempDir("", "store-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDisk(parent, maxBytes)
+	if err != nil {
+		os.RemoveAll(parent)
+		t.Fatal(err)
+	}
+	return d, func() {
+		d.Close()
+		os.RemoveAll(parent)
+	}
+}
+
+// testStores runs test against each Store implementation, the Redis one with a fakeRedis
+func testStores(t *testing.T, test func(t *testing.T, s Store)) {
+	t.Run("Memory", func(t *testing.T) {
+		test(t, NewMemory(1<<20, 4))
+	})
+	t.Run("Disk", func(t *testing.T) {
+		d, cleanup := newDisk(t, 1<<20)
+		defer cleanup()
+		test(t, d)
+	})
+	t.Run("Redis", func(t *testing.T) {
+		r, _, cleanup := newRedis(t)
+		defer cleanup()
+		test(t, r)
+	})
+}
+
+func assertValue(t *testing.T, s Store, key string, want []byte) {
+	t.Helper()
+	value, ok, err := s.Get(key)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", key, err)
+	}
+	switch {
+	case want == nil && ok:
+		t.Errorf("Get(%q) = %q, want missing", key, value)
+	case want != nil && !ok:
+		t.Errorf("Get(%q) is missing, want %q", key, want)
+	case want != nil && !bytes.Equal(value, want):
+		t.Errorf("Get(%q) = %q, want %q", key, value, want)
+	}
+}
+
+func keys(t *testing.T, s Store) []string {
+	t.Helper()
+	var keys []string
+	if err := s.Keys(func(key string) error {
+		keys = append(keys, key)
+		return nil
+	}); err != nil {
+		t.Fatalf("Keys: %v", err)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestRoundTrip(t *testing.T) {
+	testStores(t, func(t *testing.T, s Store) {
+		assertValue(t, s, "missing", nil)
+		if err := s.Set("a", []byte("1"), 0); err != nil {
+			t.Fatal(err)
+		}
+		// keys may be long and contain slashes
+		long := "GET /" + string(bytes.Repeat([]byte("x/"), 200))
+		if err := s.Set(long, []byte("2"), time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		assertValue(t, s, "a", []byte("1"))
+		assertValue(t, s, long, []byte("2"))
+
+		if err := s.Set("a", []byte("replaced"), 0); err != nil {
+			t.Fatal(err)
+		}
+		assertValue(t, s, "a", []byte("replaced"))
+		if got := keys(t, s); len(got) != 2 {
+			t.Errorf("Keys = %q, want 2 keys", got)
+		}
+		stats, err := s.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Entries != 2 {
+			t.Errorf("Stats().Entries = %d, want 2", stats.Entries)
+		}
+
+		if err := s.Delete("a"); err != nil {
+			t.Fatal(err)
+		}
+		assertValue(t, s, "a", nil)
+		if err := s.Delete("a"); err != nil {
+			t.Errorf("Delete of a missing key: %v", err)
+		}
+		if err := s.Purge(); err != nil {
+			t.Fatal(err)
+		}
+		assertValue(t, s, long, nil)
+		if got := keys(t, s); len(got) != 0 {
+			t.Errorf("Keys after Purge = %q, want none", got)
+		}
+	})
+}
+
+func TestKeysAllowsChanges(t *testing.T) {
+	testStores(t, func(t *testing.T, s Store) {
+		for _, key := range []string{"a", "b", "c"} {
+			if err := s.Set(key, []byte(key), 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// f deletes the values it's called with, as the purges do
+		err := s.Keys(func(key string) error {
+			if _, _, err := s.Get(key); err != nil {
+				return err
+			}
+			return s.Delete(key)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := keys(t, s); len(got) != 0 {
+			t.Errorf("Keys = %q, want none", got)
+		}
+	})
+}
+
+func TestExpiry(t *testing.T) {
+	testStores(t, func(t *testing.T, s Store) {
+		if err := s.Set("short", []byte("1"), 10*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Set("long", []byte("2"), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Set("forever", []byte("3"), 0); err != nil {
+			t.Fatal(err)
+		}
+		assertValue(t, s, "short", []byte("1"))
+		time.Sleep(20 * time.Millisecond)
+		assertValue(t, s, "short", nil)
+		assertValue(t, s, "long", []byte("2"))
+		assertValue(t, s, "forever", []byte("3"))
+	})
+}
+
+func TestMemoryEviction(t *testing.T) {
+	for _, shards := range []int{1, 4} {
+		t.Run(fmt.Sprintf("%d shards", shards), func(t *testing.T) {
+			// 30 bytes hold 3 values of 10 bytes with their key, whatever their shard
+			m := NewMemory(30, shards)
+			value := []byte("123456789")
+			for _, key := range []string{"a", "b", "c"} {
+				if err := m.Set(key, value, 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// a is used, b is now the least recently used
+			assertValue(t, m, "a", value)
+			if err := m.Set("d", value, 0); err != nil {
+				t.Fatal(err)
+			}
+			assertValue(t, m, "b", nil)
+			for _, key := range []string{"a", "c", "d"} {
+				assertValue(t, m, key, value)
+			}
+
+			stats, _ := m.Stats()
+			if stats.Entries != 3 || stats.Bytes != 30 || stats.Evictions != 1 {
+				t.Errorf("Stats() = %+v, want 3 entries of 30 bytes and 1 eviction", stats)
+			}
+			if err := m.Set("e", make([]byte, 30), 0); err != ErrTooLarge {
+				t.Errorf("Set of a value larger than the store: got %v, want ErrTooLarge", err)
+			}
+			// a value may take the whole store
+			if err := m.Set("e", make([]byte, 29), 0); err != nil {
+				t.Fatal(err)
+			}
+			if stats, _ := m.Stats(); stats.Entries != 1 || stats.Bytes != 30 || stats.Evictions != 4 {
+				t.Errorf("Stats() = %+v, want 1 entry of 30 bytes and 4 evictions", stats)
+			}
+		})
+	}
+}
+
+func TestDiskEviction(t *testing.T) {
+	d, cleanup := newDisk(t, 30)
+	defer cleanup()
+	value := []byte("0123456789")
+	for _, key := range []string{"a", "b", "c"} {
+		if err := d.Set(key, value, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertValue(t, d, "a", value)
+	if err := d.Set("d", value, 0); err != nil {
+		t.Fatal(err)
+	}
+	assertValue(t, d, "b", nil)
+	for _, key := range []string{"a", "c", "d"} {
+		assertValue(t, d, key, value)
+	}
+
+	stats, _ := d.Stats()
+	if stats.Entries != 3 || stats.Bytes != 30 || stats.Evictions != 1 {
+		t.Errorf("Stats() = %+v, want 3 entries of 30 bytes and 1 eviction", stats)
+	}
+	// the files of the evicted and deleted values are removed
+	files, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Errorf("%d files in the directory of the store, want 3", len(files))
+	}
+	if err := d.Set("e", make([]byte, 31), 0); err != ErrTooLarge {
+		t.Errorf("Set of a value larger than the store: got %v, want ErrTooLarge", err)
+	}
+}
+
+func TestDiskRemovesStaleDirs(t *testing.T) {
+	parent, err := ioutil.TempDir("", "store-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(parent)
+	stale := filepath.Join(parent, diskDirPrefix+"previous-process")
+	other := filepath.Join(parent, "other")
+	for _, dir := range []string{stale, other} {
+		if err := os.Mkdir(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, err := NewDisk(parent, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("the directory of a previous process is still there: %v", err)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("another directory has been deleted: %v", err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(d.dir); !os.IsNotExist(err) {
+		t.Errorf("the directory of the store is still there after Close: %v", err)
+	}
+}
@@ -0,0 +1,10 @@
+package webhook
+
+import (
+	"service-cache-operator/pkg/webhook/validation"
+)
+
+func init() {
+	// AddToServerFuncs is a list of functions to create webhooks and add them to the webhook server.
+	AddToServerFuncs = append(AddToServerFuncs, validation.AddServiceCache, validation.AddService)
+}
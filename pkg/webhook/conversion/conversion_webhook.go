@@ -0,0 +1,157 @@
+package conversion
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"service-cache-operator/pkg/apis/conversion"
+
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+var log = logf.Log.WithName("webhook_conversion")
+
+// webhook converts the custom resources of the operator between their versions, for the API server. The types of the
+// versions are found in its scheme, each version is converted to and from the Hub of its kind.
+type webhook struct {
+	scheme *runtime.Scheme
+}
+
+// blank assignment to verify that webhook implements http.Handler
+var _ http.Handler = &webhook{}
+
+// ServeHTTP answers the ConversionReview of the request with the objects converted to the desired version
+func (wh *webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	review := &apiextensionsv1beta1.ConversionReview{}
+	if err := json.NewDecoder(r.Body).Decode(review); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if review.Request == nil {
+		http.Error(w, "the ConversionReview has no request", http.StatusBadRequest)
+		return
+	}
+
+	review.Response = wh.convertReview(review.Request)
+	review.Request = nil
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		log.Error(err, "Failed to write the ConversionReview", "UID", review.Response.UID)
+	}
+}
+
+// convertReview converts the objects of req, the response fails if any of them cannot be converted
+func (wh *webhook) convertReview(req *apiextensionsv1beta1.ConversionRequest) *apiextensionsv1beta1.ConversionResponse {
+	resp := &apiextensionsv1beta1.ConversionResponse{UID: req.UID}
+	gv, err := schema.ParseGroupVersion(req.DesiredAPIVersion)
+	if err != nil {
+		resp.Result = metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}
+		return resp
+	}
+	for _, obj := range req.Objects {
+		converted, err := wh.convert(obj.Raw, gv)
+		if err != nil {
+			log.Error(err, "Failed to convert an object", "DesiredAPIVersion", req.DesiredAPIVersion)
+			resp.ConvertedObjects = nil
+			resp.Result = metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}
+			return resp
+		}
+		resp.ConvertedObjects = append(resp.ConvertedObjects, runtime.RawExtension{Raw: converted})
+	}
+	resp.Result = metav1.Status{Status: metav1.StatusSuccess}
+	return resp
+}
+
+// convert returns the JSON encoding of the object data converted to the version gv
+func (wh *webhook) convert(data []byte, gv schema.GroupVersion) ([]byte, error) {
+	typeMeta := &metav1.TypeMeta{}
+	if err := json.Unmarshal(data, typeMeta); err != nil {
+		return nil, err
+	}
+	srcGVK := typeMeta.GroupVersionKind()
+	dstGVK := gv.WithKind(srcGVK.Kind)
+	if srcGVK == dstGVK {
+		return data, nil
+	}
+
+	src, err := wh.scheme.New(srcGVK)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, src); err != nil {
+		return nil, err
+	}
+	dst, err := wh.scheme.New(dstGVK)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case isHub(dst):
+		spoke, ok := src.(conversion.Convertible)
+		if !ok {
+			return nil, fmt.Errorf("%s is not convertible", srcGVK)
+		}
+		err = spoke.ConvertTo(dst.(conversion.Hub))
+	case isHub(src):
+		spoke, ok := dst.(conversion.Convertible)
+		if !ok {
+			return nil, fmt.Errorf("%s is not convertible", dstGVK)
+		}
+		err = spoke.ConvertFrom(src.(conversion.Hub))
+	default:
+		err = wh.convertThroughHub(src, dst, srcGVK.GroupKind())
+	}
+	if err != nil {
+		return nil, err
+	}
+	dst.GetObjectKind().SetGroupVersionKind(dstGVK)
+	return json.Marshal(dst)
+}
+
+// convertThroughHub converts src to dst, two versions of the kind gk which are not its Hub
+func (wh *webhook) convertThroughHub(src, dst runtime.Object, gk schema.GroupKind) error {
+	srcSpoke, ok := src.(conversion.Convertible)
+	if !ok {
+		return fmt.Errorf("%T is not convertible", src)
+	}
+	dstSpoke, ok := dst.(conversion.Convertible)
+	if !ok {
+		return fmt.Errorf("%T is not convertible", dst)
+	}
+	hub, err := wh.hubOf(gk)
+	if err != nil {
+		return err
+	}
+	if err := srcSpoke.ConvertTo(hub); err != nil {
+		return err
+	}
+	return dstSpoke.ConvertFrom(hub)
+}
+
+// hubOf returns a new object of the Hub version of the kind gk
+func (wh *webhook) hubOf(gk schema.GroupKind) (conversion.Hub, error) {
+	for gvk := range wh.scheme.AllKnownTypes() {
+		if gvk.GroupKind() != gk {
+			continue
+		}
+		obj, err := wh.scheme.New(gvk)
+		if err != nil {
+			return nil, err
+		}
+		if hub, ok := obj.(conversion.Hub); ok {
+			return hub, nil
+		}
+	}
+	return nil, fmt.Errorf("%s has no Hub version", gk)
+}
+
+func isHub(obj runtime.Object) bool {
+	_, ok := obj.(conversion.Hub)
+	return ok
+}
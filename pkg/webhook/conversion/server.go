@@ -0,0 +1,174 @@
+package conversion
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ServiceName is the name of the Service of the conversion webhook, in the namespace of the operator
+const ServiceName = "service-cache-operator-conversion"
+
+// path is the path the conversion webhook is served on
+const path = "/convert"
+
+// ServingLabel is set on the pod of the operator serving the conversion webhook, and selected by its Service: the
+// replicas which are not the leader don't serve it
+const ServingLabel = "operator.service-cache.github.io/conversion-webhook"
+
+// CRDs are the names of the CustomResourceDefinitions whose objects are converted by the webhook
+var CRDs = []string{
+	"servicecaches.cache.service-cache.github.com",
+	"servicecachepurges.cache.service-cache.github.com",
+}
+
+// Server serves the conversion webhook of the CustomResourceDefinitions of the operator. Unlike the admission
+// webhooks, it's always served: the API server cannot read the objects stored in another version without it.
+type Server struct {
+	client    client.Client
+	scheme    *runtime.Scheme
+	namespace string
+	podName   string
+	port      int32
+	listener  net.Listener
+}
+
+// NewServer returns the Server of the conversion webhook listening on port, with a Service in namespace selecting
+// the pod podName. c must read the API server directly, the cache of the manager may not be started.
+func NewServer(c client.Client, scheme *runtime.Scheme, namespace, podName string, port int32) *Server {
+	return &Server{client: c, scheme: scheme, namespace: namespace, podName: podName, port: port}
+}
+
+// Install creates a serving certificate, listens on the port of the Server, labels the pod of the Server so that its
+// Service selects it, and points the CustomResourceDefinitions at the Service. The conversion requests of the API
+// server wait for Start.
+func (s *Server) Install() error {
+	dnsName := fmt.Sprintf("%s.%s.svc", ServiceName, s.namespace)
+	caBundle, cert, err := newCertificate(dnsName)
+	if err != nil {
+		return err
+	}
+	s.listener, err = tls.Listen("tcp", fmt.Sprintf(":%d", s.port), &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		return err
+	}
+	if err := s.labelPod(); err != nil {
+		return err
+	}
+	if err := s.reconcileService(); err != nil {
+		return err
+	}
+	for _, name := range CRDs {
+		if err := s.reconcileCRD(name, caBundle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start serves the conversion webhook until stop is closed. It must be called after Install.
+func (s *Server) Start(stop <-chan struct{}) error {
+	mux := http.NewServeMux()
+	mux.Handle(path, &webhook{scheme: s.scheme})
+	srv := &http.Server{Handler: mux}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.Serve(s.listener)
+	}()
+	log.Info("Serving the conversion webhook", "Port", s.port)
+	select {
+	case <-stop:
+		return srv.Shutdown(context.Background())
+	case err := <-errs:
+		return err
+	}
+}
+
+// labelPod sets ServingLabel on the pod of the Server
+func (s *Server) labelPod() error {
+	pod := &corev1.Pod{}
+	err := s.client.Get(context.TODO(), types.NamespacedName{Namespace: s.namespace, Name: s.podName}, pod)
+	if err != nil {
+		return err
+	}
+	if pod.Labels[ServingLabel] == "true" {
+		return nil
+	}
+	if pod.Labels == nil {
+		pod.Labels = map[string]string{}
+	}
+	pod.Labels[ServingLabel] = "true"
+	return s.client.Update(context.TODO(), pod)
+}
+
+// reconcileService creates or updates the Service of the webhook, selecting the pod of the operator serving it
+func (s *Server) reconcileService() error {
+	ports := []corev1.ServicePort{{
+		Name:       "https",
+		Port:       443,
+		TargetPort: intstr.FromInt(int(s.port)),
+	}}
+	// Selector should select the pods running the operator, see deploy/operator.yaml, and only the one serving the
+	// webhook
+	selector := map[string]string{"name": "service-cache-operator", ServingLabel: "true"}
+
+	svc := &corev1.Service{}
+	err := s.client.Get(context.TODO(), types.NamespacedName{Namespace: s.namespace, Name: ServiceName}, svc)
+	if errors.IsNotFound(err) {
+		svc = &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: s.namespace, Name: ServiceName},
+			Spec:       corev1.ServiceSpec{Ports: ports, Selector: selector},
+		}
+		return s.client.Create(context.TODO(), svc)
+	} else if err != nil {
+		return err
+	}
+	svc.Spec.Ports = ports
+	svc.Spec.Selector = selector
+	return s.client.Update(context.TODO(), svc)
+}
+
+// reconcileCRD sets the webhook as the converter of the CustomResourceDefinition name. The CustomResourceDefinition
+// is updated as unstructured: the apiextensions types of the client don't have all its fields, e.g. the
+// x-kubernetes-* extensions of its schemas, which would be dropped.
+func (s *Server) reconcileCRD(name string, caBundle []byte) error {
+	crd := &unstructured.Unstructured{}
+	crd.SetGroupVersionKind(apiextensionsv1beta1.SchemeGroupVersion.WithKind("CustomResourceDefinition"))
+	if err := s.client.Get(context.TODO(), types.NamespacedName{Name: name}, crd); err != nil {
+		return err
+	}
+	service := map[string]interface{}{
+		"namespace": s.namespace,
+		"name":      ServiceName,
+		"path":      path,
+	}
+	fields := []struct {
+		value interface{}
+		path  []string
+	}{
+		{string(apiextensionsv1beta1.WebhookConverter), []string{"spec", "conversion", "strategy"}},
+		{service, []string{"spec", "conversion", "webhookClientConfig", "service"}},
+		{base64.StdEncoding.EncodeToString(caBundle), []string{"spec", "conversion", "webhookClientConfig", "caBundle"}},
+	}
+	for _, f := range fields {
+		if err := unstructured.SetNestedField(crd.Object, f.value, f.path...); err != nil {
+			return err
+		}
+	}
+	unstructured.RemoveNestedField(crd.Object, "spec", "conversion", "webhookClientConfig", "url")
+	return s.client.Update(context.TODO(), crd)
+}
@@ -0,0 +1,233 @@
+package sidecar
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	cachev1beta1 "service-cache-operator/pkg/apis/cache/v1beta1"
+	controller_utils "service-cache-operator/pkg/controller/utils"
+
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission/builder"
+	atypes "sigs.k8s.io/controller-runtime/pkg/webhook/admission/types"
+)
+
+var log = logf.Log.WithName("webhook_sidecar")
+
+// KeyOfInject is the pod annotation to opt a pod out of the sidecar injection, by setting it to "false"
+const KeyOfInject = "sidecar.service-cache.github.io/inject"
+
+// Add creates the mutating webhook injecting the cache proxy sidecar into the pods selected by the Services in
+// sidecar mode.
+func Add(mgr manager.Manager) (webhook.Webhook, error) {
+	return builder.NewWebhookBuilder().
+		Name("sidecar.service-cache.github.io").
+		Path("/mutate-pods-sidecar").
+		Mutating().
+		Operations(admissionregistrationv1beta1.Create).
+		// never block pod creation because the operator is down
+		FailurePolicy(admissionregistrationv1beta1.Ignore).
+		// only the namespaces opted in, see --namespace-selector
+		NamespaceSelector(controller_utils.ControllerOptions.NamespaceSelector).
+		ForType(&corev1.Pod{}).
+		Handlers(&sidecarInjector{}).
+		WithManager(mgr).
+		Build()
+}
+
+// sidecarInjector injects the cache proxy sidecar into pods
+type sidecarInjector struct {
+	client  client.Client
+	decoder atypes.Decoder
+}
+
+// blank assignments to verify that sidecarInjector implements the interfaces
+var _ admission.Handler = &sidecarInjector{}
+var _ inject.Client = &sidecarInjector{}
+var _ inject.Decoder = &sidecarInjector{}
+
+// InjectClient injects the client into the sidecarInjector
+func (h *sidecarInjector) InjectClient(c client.Client) error {
+	h.client = c
+	return nil
+}
+
+// InjectDecoder injects the decoder into the sidecarInjector
+func (h *sidecarInjector) InjectDecoder(d atypes.Decoder) error {
+	h.decoder = d
+	return nil
+}
+
+// Handle adds the cache proxy sidecar to the pod if it's selected by a Service in sidecar mode
+func (h *sidecarInjector) Handle(ctx context.Context, req atypes.Request) atypes.Response {
+	pod := &corev1.Pod{}
+	if err := h.decoder.Decode(req, pod); err != nil {
+		return admission.ErrorResponse(http.StatusBadRequest, err)
+	}
+	// the namespace of the pod is not always set on creation
+	namespace := req.AdmissionRequest.Namespace
+	logger := log.WithValues("Pod.Namespace", namespace, "Pod.Name", pod.Name, "Pod.GenerateName", pod.GenerateName)
+
+	if !needsInjection(pod) {
+		return admission.ValidationResponse(true, "")
+	}
+
+	svc, sc, err := h.findCachedService(ctx, namespace, pod)
+	if err != nil {
+		logger.Error(err, "Failed to find the Service of the pod")
+		return admission.ErrorResponse(http.StatusInternalServerError, err)
+	}
+	if svc == nil {
+		return admission.ValidationResponse(true, "")
+	}
+
+	sidecar, err := newSidecar(svc, sc, pod)
+	if err != nil {
+		logger.Error(err, "Failed to build the cache proxy sidecar", "Service.Name", svc.Name)
+		return admission.ValidationResponse(true, "")
+	}
+
+	mutated := pod.DeepCopy()
+	mutated.Spec.Containers = append(mutated.Spec.Containers, *sidecar)
+	mutated.Spec.Volumes = append(mutated.Spec.Volumes, controller_utils.ProxyCacheVolume())
+	logger.Info("Inject the cache proxy sidecar", "Service.Name", svc.Name)
+	return admission.PatchResponse(pod, mutated)
+}
+
+// needsInjection returns false if the pod is a cache proxy, already has the sidecar, opted out or doesn't mount the
+// token of its ServiceAccount, which the sidecar reads the ServiceCache with
+func needsInjection(pod *corev1.Pod) bool {
+	if pod.Labels["app.kubernetes.io/name"] == controller_utils.ProxyAppName {
+		return false
+	}
+	if pod.Annotations[KeyOfInject] == "false" {
+		return false
+	}
+	if mount := pod.Spec.AutomountServiceAccountToken; mount != nil && !*mount {
+		return false
+	}
+	for _, c := range pod.Spec.Containers {
+		if c.Name == controller_utils.ProxyContainerName {
+			return false
+		}
+	}
+	return true
+}
+
+// findCachedService returns the Service in sidecar mode selecting the pod and its ServiceCache, or nil
+func (h *sidecarInjector) findCachedService(ctx context.Context, namespace string, pod *corev1.Pod) (*corev1.Service, *cachev1beta1.ServiceCache, error) {
+	services := &corev1.ServiceList{}
+	if err := h.client.List(ctx, &client.ListOptions{Namespace: namespace}, services); err != nil {
+		return nil, nil, err
+	}
+	for i := range services.Items {
+		svc := &services.Items[i]
+		if !controller_utils.IsAnnotated(svc) {
+			continue
+		}
+		selector, err := originalSelector(svc)
+		if err != nil || len(selector) == 0 || !labels.SelectorFromSet(selector).Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+
+		sc := &cachev1beta1.ServiceCache{}
+		err = h.client.Get(ctx, types.NamespacedName{Name: svc.Name, Namespace: namespace}, sc)
+		if err != nil {
+			continue
+		}
+		if controller_utils.ModeOf(sc) == cachev1beta1.CacheModeSidecar {
+			return svc, sc, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// originalSelector returns the selector of svc before it was routed to the cache proxy
+func originalSelector(svc *corev1.Service) (map[string]string, error) {
+	routing, err := controller_utils.GetOriginalRouting(svc)
+	if err != nil || routing == nil {
+		return svc.Spec.Selector, err
+	}
+	return routing.Selector, nil
+}
+
+// newSidecar returns the cache proxy container forwarding to the port of the pod targeted by svc, configured by sc
+func newSidecar(svc *corev1.Service, sc *cachev1beta1.ServiceCache, pod *corev1.Pod) (*corev1.Container, error) {
+	image := os.Getenv(controller_utils.ProxyImageEnvVar)
+	if image == "" {
+		return nil, fmt.Errorf("%s must be set to inject the cache proxy", controller_utils.ProxyImageEnvVar)
+	}
+	if len(svc.Spec.Ports) != 1 {
+		return nil, fmt.Errorf("Service must have a single port")
+	}
+
+	targetPort := svc.Spec.Ports[0].TargetPort
+	routing, err := controller_utils.GetOriginalRouting(svc)
+	if err != nil {
+		return nil, err
+	}
+	if routing != nil {
+		targetPort = routing.TargetPort
+	}
+	port, err := resolvePort(targetPort, svc.Spec.Ports[0].Port, pod)
+	if err != nil {
+		return nil, err
+	}
+
+	upstream := fmt.Sprintf("http://127.0.0.1:%d", port)
+	return &corev1.Container{
+		Name:    controller_utils.ProxyContainerName,
+		Image:   image,
+		Command: []string{"service-cache-proxy"},
+		Args:    controller_utils.ProxyArgs(controller_utils.SidecarPort, controller_utils.SidecarAdminPort, upstream, svc),
+		Env:     controller_utils.ProxyEnv(sc),
+		Ports: []corev1.ContainerPort{{
+			Name:          controller_utils.SidecarPortName,
+			ContainerPort: controller_utils.SidecarPort,
+			Protocol:      corev1.ProtocolTCP,
+		}, {
+			Name:          controller_utils.ProxyAdminPortName,
+			ContainerPort: controller_utils.SidecarAdminPort,
+			Protocol:      corev1.ProtocolTCP,
+		}},
+		VolumeMounts: []corev1.VolumeMount{controller_utils.ProxyCacheVolumeMount()},
+		ReadinessProbe: &corev1.Probe{
+			Handler: corev1.Handler{
+				TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(controller_utils.SidecarPort)},
+			},
+		},
+	}, nil
+}
+
+// resolvePort returns the container port number of targetPort, which defaults to servicePort
+func resolvePort(targetPort intstr.IntOrString, servicePort int32, pod *corev1.Pod) (int32, error) {
+	if targetPort.Type == intstr.Int {
+		if targetPort.IntVal == 0 {
+			return servicePort, nil
+		}
+		return targetPort.IntVal, nil
+	}
+	if targetPort.StrVal == "" {
+		return servicePort, nil
+	}
+	for _, c := range pod.Spec.Containers {
+		for _, p := range c.Ports {
+			if p.Name == targetPort.StrVal {
+				return p.ContainerPort, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("no container port named %q", targetPort.StrVal)
+}
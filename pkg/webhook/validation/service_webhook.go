@@ -0,0 +1,70 @@
+package validation
+
+import (
+	"context"
+	"net/http"
+
+	controller_utils "service-cache-operator/pkg/controller/utils"
+
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission/builder"
+	atypes "sigs.k8s.io/controller-runtime/pkg/webhook/admission/types"
+)
+
+var log = logf.Log.WithName("webhook_validation")
+
+// AddService creates the validating webhook rejecting the Services with invalid service cache annotations
+func AddService(mgr manager.Manager) (webhook.Webhook, error) {
+	return builder.NewWebhookBuilder().
+		Name("validate-service.service-cache.github.io").
+		Path("/validate-services").
+		Validating().
+		Operations(admissionregistrationv1beta1.Create, admissionregistrationv1beta1.Update).
+		// never block the changes of Services because the operator is down
+		FailurePolicy(admissionregistrationv1beta1.Ignore).
+		// only the namespaces opted in, see --namespace-selector
+		NamespaceSelector(controller_utils.ControllerOptions.NamespaceSelector).
+		ForType(&corev1.Service{}).
+		Handlers(&serviceValidator{}).
+		WithManager(mgr).
+		Build()
+}
+
+// serviceValidator validates the service cache annotations of Services
+type serviceValidator struct {
+	decoder atypes.Decoder
+}
+
+// blank assignments to verify that serviceValidator implements the interfaces
+var _ admission.Handler = &serviceValidator{}
+var _ inject.Decoder = &serviceValidator{}
+
+// InjectDecoder injects the decoder into the serviceValidator
+func (v *serviceValidator) InjectDecoder(d atypes.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle rejects the Service if its service cache annotations are invalid
+func (v *serviceValidator) Handle(ctx context.Context, req atypes.Request) atypes.Response {
+	svc := &corev1.Service{}
+	if err := v.decoder.Decode(req, svc); err != nil {
+		return admission.ErrorResponse(http.StatusBadRequest, err)
+	}
+	if !controller_utils.IsAnnotated(svc) {
+		return admission.ValidationResponse(true, "")
+	}
+
+	if errs := controller_utils.ValidateServiceAnnotations(svc.Annotations); len(errs) > 0 {
+		log.Info("Reject the Service", "Service.Namespace", req.AdmissionRequest.Namespace,
+			"Service.Name", svc.Name, "Reason", errs.ToAggregate().Error())
+		return admission.ValidationResponse(false, errs.ToAggregate().Error())
+	}
+	return admission.ValidationResponse(true, "")
+}
@@ -0,0 +1,87 @@
+package validation
+
+import (
+	"context"
+	"net/http"
+
+	cachev1alpha1 "service-cache-operator/pkg/apis/cache/v1alpha1"
+	cachev1beta1 "service-cache-operator/pkg/apis/cache/v1beta1"
+	controller_utils "service-cache-operator/pkg/controller/utils"
+
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission/builder"
+	atypes "sigs.k8s.io/controller-runtime/pkg/webhook/admission/types"
+)
+
+// AddServiceCache creates the validating webhook rejecting the ServiceCache objects with an invalid configuration
+func AddServiceCache(mgr manager.Manager) (webhook.Webhook, error) {
+	return builder.NewWebhookBuilder().
+		Name("validate-servicecache.service-cache.github.io").
+		Path("/validate-servicecaches").
+		Validating().
+		// every served version: the API server doesn't convert the objects sent to admission webhooks
+		Rules(admissionregistrationv1beta1.RuleWithOperations{
+			Operations: []admissionregistrationv1beta1.OperationType{
+				admissionregistrationv1beta1.Create, admissionregistrationv1beta1.Update,
+			},
+			Rule: admissionregistrationv1beta1.Rule{
+				APIGroups:   []string{cachev1beta1.SchemeGroupVersion.Group},
+				APIVersions: []string{cachev1alpha1.SchemeGroupVersion.Version, cachev1beta1.SchemeGroupVersion.Version},
+				Resources:   []string{"servicecaches"},
+			},
+		}).
+		FailurePolicy(admissionregistrationv1beta1.Fail).
+		// only the namespaces opted in, see --namespace-selector
+		NamespaceSelector(controller_utils.ControllerOptions.NamespaceSelector).
+		Handlers(&serviceCacheValidator{}).
+		WithManager(mgr).
+		Build()
+}
+
+// serviceCacheValidator validates ServiceCache objects
+type serviceCacheValidator struct {
+	decoder atypes.Decoder
+}
+
+// blank assignments to verify that serviceCacheValidator implements the interfaces
+var _ admission.Handler = &serviceCacheValidator{}
+var _ inject.Decoder = &serviceCacheValidator{}
+
+// InjectDecoder injects the decoder into the serviceCacheValidator
+func (v *serviceCacheValidator) InjectDecoder(d atypes.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle rejects the ServiceCache if its configuration is invalid
+func (v *serviceCacheValidator) Handle(ctx context.Context, req atypes.Request) atypes.Response {
+	sc, err := v.decode(req)
+	if err != nil {
+		return admission.ErrorResponse(http.StatusBadRequest, err)
+	}
+
+	if errs := controller_utils.ValidateServiceCacheSpec(&sc.Spec, field.NewPath("spec")); len(errs) > 0 {
+		log.Info("Reject the ServiceCache", "ServiceCache.Namespace", req.AdmissionRequest.Namespace,
+			"ServiceCache.Name", sc.Name, "Reason", errs.ToAggregate().Error())
+		return admission.ValidationResponse(false, errs.ToAggregate().Error())
+	}
+	return admission.ValidationResponse(true, "")
+}
+
+// decode returns the ServiceCache of req, converted to v1beta1
+func (v *serviceCacheValidator) decode(req atypes.Request) (*cachev1beta1.ServiceCache, error) {
+	sc := &cachev1beta1.ServiceCache{}
+	if req.AdmissionRequest.Kind.Version != cachev1alpha1.SchemeGroupVersion.Version {
+		return sc, v.decoder.Decode(req, sc)
+	}
+	legacy := &cachev1alpha1.ServiceCache{}
+	if err := v.decoder.Decode(req, legacy); err != nil {
+		return nil, err
+	}
+	return sc, legacy.ConvertTo(sc)
+}
@@ -0,0 +1,51 @@
+package webhook
+
+import (
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	ctrlwebhook "sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// ServerName is the name of the admission webhook server, used for its Service and its certificate Secret
+const ServerName = "service-cache-operator-webhook"
+
+// AddToServerFuncs is a list of functions to create webhooks and add them to the webhook server
+var AddToServerFuncs []func(manager.Manager) (ctrlwebhook.Webhook, error)
+
+// AddToManager creates the webhook server serving all webhooks on port, and adds it to the Manager.
+// The Service, the certificate Secret and the webhook configurations are created in namespace on start.
+func AddToManager(m manager.Manager, namespace string, port int32) error {
+	svr, err := ctrlwebhook.NewServer(ServerName, m, ctrlwebhook.ServerOptions{
+		Port:    port,
+		CertDir: "/tmp/cert",
+		BootstrapOptions: &ctrlwebhook.BootstrapOptions{
+			MutatingWebhookConfigName:   "service-cache-operator",
+			ValidatingWebhookConfigName: "service-cache-operator",
+			Secret: &types.NamespacedName{
+				Namespace: namespace,
+				Name:      ServerName + "-cert",
+			},
+			Service: &ctrlwebhook.Service{
+				Namespace: namespace,
+				Name:      ServerName,
+				// Selectors should select the pods running the operator, see deploy/operator.yaml
+				Selectors: map[string]string{
+					"name": "service-cache-operator",
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	var webhooks []ctrlwebhook.Webhook
+	for _, f := range AddToServerFuncs {
+		wh, err := f(m)
+		if err != nil {
+			return err
+		}
+		webhooks = append(webhooks, wh)
+	}
+	return svr.Register(webhooks...)
+}